@@ -1,9 +1,16 @@
 package main
 
 import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"net/http"
 	"os"
+	"path/filepath"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/najeal/gvy/internal"
@@ -21,36 +28,346 @@ const (
 
 const configPath = "inco.yaml"
 
-func runTests() error {
-	cfgBytes, err := os.ReadFile(configPath)
+const reportFormatJUnit = "junit"
+
+func runTests(ctx context.Context, timeout time.Duration, parallel int, reports []string, coverage bool) error {
+	reportPaths, err := parseReports(reports)
+	if err != nil {
+		return err
+	}
+	config, err := loadConfig(checkAll)
 	if err != nil {
 		return err
 	}
-	config := internal.LoadConfig(cfgBytes)
-	if !internal.ExecuteTests(config.TestPaths, os.Stdout, os.Stderr) {
+	opts := config.Test
+	if timeout > 0 {
+		opts.Timeout = timeout
+	}
+	if parallel > 0 {
+		opts.Parallel = parallel
+	}
+	paths, err := internal.ExpandTestPaths(config.TestPaths)
+	if err != nil {
+		return err
+	}
+	scripts := configScripts(config)
+	if coverage {
+		agent, err := internal.CoverageAgent(opts.Coverage, scripts)
+		if err != nil {
+			return err
+		}
+		opts.JVMOpts = append(slices.Clone(opts.JVMOpts), agent)
+	}
+	results, err := internal.ExecuteTests(ctx, paths, scripts, os.Stdout, os.Stderr, opts)
+	if err != nil {
+		return err
+	}
+	for _, path := range reportPaths {
+		var report bytes.Buffer
+		if err := internal.WriteJUnitReport(results, &report); err != nil {
+			return err
+		}
+		if err := writeFile(path, report.Bytes()); err != nil {
+			return err
+		}
+	}
+	var coverages []internal.ScriptCoverage
+	if coverage {
+		if coverages, err = internal.WriteCoverageReports(ctx, opts.Coverage, scripts, os.Stdout, os.Stderr); err != nil {
+			return err
+		}
+		for _, c := range coverages {
+			fmt.Printf("COVERAGE %s %.1f%% (%d/%d lines)\n", c.Path, c.Percent(), c.Covered, c.Covered+c.Missed)
+		}
+	}
+	if !internal.TestsPassed(results) {
 		return fmt.Errorf("tests failed")
 	}
+	if coverage {
+		return internal.CheckCoverage(coverages, opts.Coverage.MinLineCoverage)
+	}
 	return nil
 }
 
-func runUploads() error {
-	cfgBytes, err := os.ReadFile(configPath)
+// runWatch runs the tests, then re-runs the tests affected by every change of src, the test paths and the scripts.
+// With upload, the changed scripts are uploaded once their tests passed, over one BTPClient session.
+func runWatch(ctx context.Context, upload bool, opts internal.WatchOptions) error {
+	config, err := loadConfig(checkAll)
 	if err != nil {
 		return err
 	}
-	clientID := os.Getenv(ENV_CPI_USER)
-	clientSecret := os.Getenv(ENV_CPI_PASSWORD)
-	config := internal.LoadConfig(cfgBytes)
+	var btpclient *internal.BTPClient
+	if upload {
+		btpclient = newBTPClient(config)
+	}
+	runAll := func() {
+		paths, err := internal.ExpandTestPaths(config.TestPaths)
+		if err != nil {
+			fmt.Printf("FAILURE expanding test paths, %v\n", err)
+			return
+		}
+		if _, err := internal.ExecuteTests(ctx, paths, configScripts(config), os.Stdout, os.Stderr, config.Test); err != nil {
+			fmt.Printf("FAILURE running tests, %v\n", err)
+		}
+	}
+	runAll()
+	fmt.Println("Watching for changes, press Ctrl-C to stop")
+	roots := func() []string { return internal.WatchRoots(config, configPath) }
+	return internal.Watch(ctx, roots, opts, func(changed []string) {
+		fmt.Printf("CHANGED %s\n", strings.Join(changed, ", "))
+		if slices.Contains(changed, filepath.Clean(configPath)) {
+			reloaded, err := loadConfig(checkAll)
+			if err != nil {
+				fmt.Printf("FAILURE loading config, %v\n", err)
+				return
+			}
+			config = reloaded
+			if upload {
+				btpclient = newBTPClient(config)
+			}
+			runAll()
+			return
+		}
+		paths, err := internal.ExpandTestPaths(config.TestPaths)
+		if err != nil {
+			fmt.Printf("FAILURE expanding test paths, %v\n", err)
+			return
+		}
+		paths, scripts := internal.AffectedTests(changed, paths, configScripts(config))
+		passed := true
+		if len(paths) > 0 || slices.ContainsFunc(scripts, func(s internal.Script) bool { return len(s.Tests) > 0 }) {
+			results, err := internal.ExecuteTests(ctx, paths, scripts, os.Stdout, os.Stderr, config.Test)
+			if err != nil {
+				fmt.Printf("FAILURE running tests, %v\n", err)
+				return
+			}
+			passed = internal.TestsPassed(results)
+		} else {
+			fmt.Println("SKIPPED tests, no test affected")
+		}
+		if !upload {
+			return
+		}
+		if !passed {
+			fmt.Println("SKIPPED uploading scripts, tests failed")
+			return
+		}
+		// the upload errors are printed per script, the watch goes on.
+		_ = internal.UploadChangedScripts(ctx, btpclient, os.ReadFile, config.UploadScripts, changed)
+	})
+}
+
+// parseReports returns the paths of the `junit=path.xml` reports.
+func parseReports(reports []string) ([]string, error) {
+	paths := make([]string, 0, len(reports))
+	for _, report := range reports {
+		format, path, ok := strings.Cut(report, "=")
+		if !ok || path == "" {
+			return nil, fmt.Errorf("invalid report %q, expected format=path", report)
+		}
+		if format != reportFormatJUnit {
+			return nil, fmt.Errorf("unknown report format %q, expected %s", format, reportFormatJUnit)
+		}
+		paths = append(paths, path)
+	}
+	return paths, nil
+}
+
+func runLint(ctx context.Context) error {
+	config, err := loadConfig(checkAll)
+	if err != nil {
+		return err
+	}
+	findings, err := internal.LintScripts(ctx, configScripts(config), config.Test)
+	printLintFindings(findings)
+	if err != nil {
+		return err
+	}
+	if internal.LintFailed(findings) {
+		return fmt.Errorf("lint failed")
+	}
+	fmt.Println("Lint completed !")
+	return nil
+}
+
+func printLintFindings(findings []internal.LintFinding) {
+	for _, finding := range findings {
+		fmt.Println(finding)
+	}
+}
+
+func runUploads(ctx context.Context, opts internal.UploadOptions, lint bool) error {
+	config, err := loadConfig(internal.ConfigChecks{Scripts: true})
+	if err != nil {
+		return err
+	}
+	if lint {
+		findings, err := internal.LintScripts(ctx, configScripts(config), config.Test)
+		printLintFindings(findings)
+		// scripts are still checked statically when groovy is not installed.
+		if errors.Is(err, internal.ErrGroovyNotFound) {
+			fmt.Printf("SKIPPED compiling scripts, %v\n", err)
+		} else if err != nil {
+			return err
+		}
+		if internal.LintFailed(findings) {
+			return fmt.Errorf("lint failed, fix the scripts or run with --no-lint")
+		}
+	}
+	if opts.Concurrency == 0 {
+		opts.Concurrency = config.Concurrency
+	}
+	btpclient := newBTPClient(config)
+	if err := internal.UploadScripts(ctx, btpclient, os.ReadFile, config.UploadScripts, opts); err != nil {
+		return err
+	}
+	fmt.Println("Upload completed !")
+	return nil
+}
+
+func runValidate() error {
+	if _, err := loadConfig(checkAll); err != nil {
+		return err
+	}
+	fmt.Println("Configuration is valid !")
+	return nil
+}
+
+func runDiff(ctx context.Context) error {
+	config, err := loadConfig(internal.ConfigChecks{})
+	if err != nil {
+		return err
+	}
+	btpclient := newBTPClient(config)
+	summary, err := internal.DiffScripts(ctx, btpclient, os.ReadFile, config.UploadScripts, os.Stdout)
+	if err != nil {
+		return err
+	}
+	fmt.Println(summary)
+	return nil
+}
+
+func runDeployStatus(ctx context.Context, format string) error {
+	config, err := loadConfig(internal.ConfigChecks{})
+	if err != nil {
+		return err
+	}
+	btpclient := newBTPClient(config)
+	return internal.DeployStatus(ctx, btpclient, config.UploadScripts, format, os.Stdout)
+}
+
+func runPull(ctx context.Context, dryRun, check bool) error {
+	config, err := loadConfig(internal.ConfigChecks{})
+	if err != nil {
+		return err
+	}
+	btpclient := newBTPClient(config)
+	if err := internal.PullScripts(ctx, btpclient, os.ReadFile, writeFile, config.UploadScripts, internal.PullOptions{DryRun: dryRun, Check: check}); err != nil {
+		return err
+	}
+	fmt.Println("Pull completed !")
+	return nil
+}
+
+func runExport(ctx context.Context, iflowID, version, out string, force bool) error {
+	// with force, the exported iflow is merged into the existing config as written, env variables aside.
+	config, err := readConfig(internal.ConfigChecks{})
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+	case err != nil:
+		return err
+	case !force:
+		return fmt.Errorf("%s already exists, use --force to merge the iflow into it", configPath)
+	}
+	btpclient := newBTPClient(withEnv(config))
+	iflow, err := internal.ExportIflow(ctx, btpclient, writeFile, internal.Iflow{ID: iflowID, Version: version}, out)
+	if err != nil {
+		return err
+	}
+	manifest, err := internal.MarshalConfig(internal.MergeIflow(config, iflow))
+	if err != nil {
+		return err
+	}
+	if err := writeFile(configPath, manifest); err != nil {
+		return err
+	}
+	fmt.Printf("Export completed, %s written !\n", configPath)
+	return nil
+}
+
+// confirmPrune asks on stdin whether the listed resources must be deleted.
+// It fails when stdin is not a terminal, as in CI, where --yes is expected.
+func confirmPrune(resources []internal.IflowResource) (bool, error) {
+	if info, err := os.Stdin.Stat(); err != nil || info.Mode()&os.ModeCharDevice == 0 {
+		return false, fmt.Errorf("stdin is not a terminal, use --yes to prune without confirmation")
+	}
+	fmt.Printf("Delete %d resources? [y/N] ", len(resources))
+	answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil {
+		return false, fmt.Errorf("reading the answer: %w, use --yes to prune without confirmation", err)
+	}
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes", nil
+}
+
+// writeFile writes data to path, creating missing parent directories.
+func writeFile(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0o644)
+}
+
+// checkAll checks every file of the manifest, for the commands reading the scripts and running the tests.
+var checkAll = internal.ConfigChecks{Scripts: true, Tests: true}
+
+// loadConfig reads the manifest, CPI URLs fall back on env variables.
+func loadConfig(checks internal.ConfigChecks) (internal.Config, error) {
+	config, err := readConfig(checks)
+	if err != nil {
+		return internal.Config{}, err
+	}
+	return withEnv(config), nil
+}
+
+// readConfig reads the manifest as written.
+func readConfig(checks internal.ConfigChecks) (internal.Config, error) {
+	cfgBytes, err := os.ReadFile(configPath)
+	if err != nil {
+		return internal.Config{}, err
+	}
+	config, err := internal.LoadConfig(cfgBytes, checks)
+	var configErrors internal.ConfigErrors
+	if errors.As(err, &configErrors) {
+		return internal.Config{}, configErrors.WithFile(configPath)
+	}
+	return config, err
+}
+
+// withEnv fills the CPI URLs missing from config with env variables.
+func withEnv(config internal.Config) internal.Config {
 	if config.IntegrationSuiteTokenURL == "" {
 		config.IntegrationSuiteTokenURL = os.Getenv(ENV_CPI_TOKEN_URL)
 	}
 	if config.IntegrationSuiteAPIURL == "" {
 		config.IntegrationSuiteAPIURL = os.Getenv(ENV_CPI_API_URL)
 	}
-	btpclient := internal.NewBTPClient(&http.Client{Timeout: timeout}, config.IntegrationSuiteTokenURL, config.IntegrationSuiteAPIURL, clientID, clientSecret)
-	if err := internal.UploadScripts(btpclient, os.ReadFile, config.UploadScripts); err != nil {
-		return err
+	return config
+}
+
+func newBTPClient(config internal.Config) *internal.BTPClient {
+	clientID := os.Getenv(ENV_CPI_USER)
+	clientSecret := os.Getenv(ENV_CPI_PASSWORD)
+	client := internal.NewBTPClient(&http.Client{Timeout: timeout}, config.IntegrationSuiteTokenURL, config.IntegrationSuiteAPIURL, clientID, clientSecret)
+	client.SetRetryPolicy(config.Retry)
+	return client
+}
+
+// configScripts returns the scripts of every iflow of the config.
+func configScripts(config internal.Config) []internal.Script {
+	var scripts []internal.Script
+	for _, iflow := range config.UploadScripts {
+		scripts = append(scripts, iflow.Scripts...)
 	}
-	fmt.Println("Upload completed !")
-	return nil
+	return scripts
 }
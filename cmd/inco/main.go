@@ -5,36 +5,215 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"os/signal"
+	"syscall"
 
+	"github.com/najeal/gvy/internal"
 	"github.com/urfave/cli/v3"
 )
 
 func main() {
+	// Ctrl-C and CI job cancellation stop the in-flight requests and groovy processes.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	cancelTimeout := context.CancelFunc(func() {})
 	cmd := &cli.Command{
 		Commands: []*cli.Command{
+			{
+				Name:  "validate",
+				Usage: "check the config and report every problem",
+				Action: func(context.Context, *cli.Command) error {
+					return runValidate()
+				},
+			},
 			{
 				Name:  "test",
 				Usage: "use config to run tests",
-				Action: func(context.Context, *cli.Command) error {
-					return runTests()
+				Flags: []cli.Flag{
+					&cli.DurationFlag{
+						Name:  "test-timeout",
+						Usage: "kill a test script running longer than this duration, defaults to the config test timeout or 5m",
+					},
+					&cli.IntFlag{
+						Name:  "parallel",
+						Usage: "maximum number of test scripts running at the same time, defaults to the config test parallel or 1",
+					},
+					&cli.StringSliceFlag{
+						Name:  "report",
+						Usage: "write a test report, junit=path.xml writes a JUnit XML report",
+					},
+					&cli.BoolFlag{
+						Name:  "coverage",
+						Usage: "measure the line coverage of the groovy scripts with JaCoCo, and write HTML and Cobertura XML reports",
+					},
+				},
+				Action: func(ctx context.Context, cmd *cli.Command) error {
+					return runTests(ctx, cmd.Duration("test-timeout"), cmd.Int("parallel"), cmd.StringSlice("report"), cmd.Bool("coverage"))
+				},
+			},
+			{
+				Name:  "watch",
+				Usage: "use config to re-run the affected tests on every change of the scripts and tests",
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:  "upload",
+						Usage: "upload the changed scripts once their tests passed",
+					},
+					&cli.DurationFlag{
+						Name:  "interval",
+						Value: internal.DefaultWatchInterval,
+						Usage: "delay between two scans of the watched files",
+					},
+					&cli.DurationFlag{
+						Name:  "debounce",
+						Value: internal.DefaultWatchDebounce,
+						Usage: "delay without change before the tests are run",
+					},
+				},
+				Action: func(ctx context.Context, cmd *cli.Command) error {
+					return runWatch(ctx, cmd.Bool("upload"), internal.WatchOptions{Interval: cmd.Duration("interval"), Debounce: cmd.Duration("debounce")})
 				},
 			},
 			{
 				Name:  "update-resources",
 				Usage: "use config to send scripts to upload iflow scripts",
-				Action: func(context.Context, *cli.Command) error {
-					return runUploads()
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:  "deploy",
+						Usage: "deploy every iflow having at least one script uploaded",
+					},
+					&cli.BoolFlag{
+						Name:  "only-changed",
+						Usage: "skip scripts whose content is identical on the tenant",
+					},
+					&cli.BoolFlag{
+						Name:  "prune",
+						Usage: "delete iflow resources of a declared type which are not in the config",
+					},
+					&cli.BoolFlag{
+						Name:  "yes",
+						Usage: "prune without asking for confirmation",
+					},
+					&cli.IntFlag{
+						Name:  "concurrency",
+						Usage: "maximum number of scripts uploaded at the same time, defaults to the config concurrency or 1",
+					},
+					&cli.BoolFlag{
+						Name:  "no-lint",
+						Usage: "upload without linting the groovy scripts first",
+					},
+				},
+				Action: func(ctx context.Context, cmd *cli.Command) error {
+					opts := internal.UploadOptions{
+						Deploy:       cmd.Bool("deploy"),
+						OnlyChanged:  cmd.Bool("only-changed"),
+						Prune:        cmd.Bool("prune"),
+						ConfirmPrune: confirmPrune,
+						Concurrency:  cmd.Int("concurrency"),
+					}
+					if cmd.Bool("yes") {
+						opts.ConfirmPrune = nil
+					}
+					return runUploads(ctx, opts, !cmd.Bool("no-lint"))
+				},
+			},
+			{
+				Name:  "lint",
+				Usage: "use config to compile the groovy scripts and check them for CPI pitfalls",
+				Action: func(ctx context.Context, _ *cli.Command) error {
+					return runLint(ctx)
+				},
+			},
+			{
+				Name:  "diff",
+				Usage: "use config to print the differences between tenant and local scripts",
+				Action: func(ctx context.Context, _ *cli.Command) error {
+					return runDiff(ctx)
+				},
+			},
+			{
+				Name:  "pull",
+				Usage: "use config to download iflow scripts into their local path",
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:  "dry-run",
+						Usage: "print the files that would be updated without writing them",
+					},
+					&cli.BoolFlag{
+						Name:  "check",
+						Usage: "fail when tenant scripts differ from local files, without writing them",
+					},
+				},
+				Action: func(ctx context.Context, cmd *cli.Command) error {
+					return runPull(ctx, cmd.Bool("dry-run"), cmd.Bool("check"))
+				},
+			},
+			{
+				Name:  "export",
+				Usage: "download an iflow as an unpacked directory and write a starter config",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:     "iflow",
+						Usage:    "id of the iflow to export",
+						Required: true,
+					},
+					&cli.StringFlag{
+						Name:  "version",
+						Value: "active",
+						Usage: "version of the iflow to export",
+					},
+					&cli.StringFlag{
+						Name:     "out",
+						Usage:    "directory the iflow is unpacked into",
+						Required: true,
+					},
+					&cli.BoolFlag{
+						Name:  "force",
+						Usage: "merge the iflow into the existing config",
+					},
+				},
+				Action: func(ctx context.Context, cmd *cli.Command) error {
+					return runExport(ctx, cmd.String("iflow"), cmd.String("version"), cmd.String("out"), cmd.Bool("force"))
+				},
+			},
+			{
+				Name:  "deploy-status",
+				Usage: "use config to report the runtime status of iflows",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:    "output",
+						Aliases: []string{"o"},
+						Value:   internal.StatusFormatTable,
+						Usage:   "output format: table or json",
+					},
+				},
+				Action: func(ctx context.Context, cmd *cli.Command) error {
+					return runDeployStatus(ctx, cmd.String("output"))
 				},
 			},
 		},
 		Name:  "inco",
 		Usage: "make groovy script manipulation easy",
+		Flags: []cli.Flag{
+			&cli.DurationFlag{
+				Name:  "timeout",
+				Usage: "stop the command after this duration, 0 means no limit",
+			},
+		},
+		Before: func(ctx context.Context, cmd *cli.Command) (context.Context, error) {
+			if timeout := cmd.Duration("timeout"); timeout > 0 {
+				ctx, cancelTimeout = context.WithTimeout(ctx, timeout)
+			}
+			return ctx, nil
+		},
 		Action: func(context.Context, *cli.Command) error {
 			fmt.Println("inco !")
 			return nil
 		},
 	}
-	if err := cmd.Run(context.Background(), os.Args); err != nil {
+	err := cmd.Run(ctx, os.Args)
+	cancelTimeout()
+	stop()
+	if err != nil {
 		log.Fatal(err)
 	}
 }
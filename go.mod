@@ -2,11 +2,14 @@ module github.com/najeal/gvy
 
 go 1.25.5
 
+require (
+	github.com/goccy/go-yaml v1.19.0
+	github.com/pmezard/go-difflib v1.0.0
+	github.com/stretchr/testify v1.11.1
+	github.com/urfave/cli/v3 v3.6.1
+)
+
 require (
 	github.com/davecgh/go-spew v1.1.1 // indirect
-	github.com/goccy/go-yaml v1.19.0 // indirect
-	github.com/pmezard/go-difflib v1.0.0 // indirect
-	github.com/stretchr/testify v1.11.1 // indirect
-	github.com/urfave/cli/v3 v3.6.1 // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
@@ -0,0 +1,71 @@
+package internal
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"strings"
+)
+
+const manifestPath = "META-INF/MANIFEST.MF"
+
+var ErrInvalidArtifact = errors.New("invalid iflow artifact")
+
+// ZipArtifact zips an unpacked iflow directory, entries are sorted by path.
+func ZipArtifact(fsys fs.FS) ([]byte, error) {
+	if _, err := fs.Stat(fsys, manifestPath); err != nil {
+		return nil, fmt.Errorf("%w: %s not found", ErrInvalidArtifact, manifestPath)
+	}
+	archive := &bytes.Buffer{}
+	zw := zip.NewWriter(archive)
+	err := fs.WalkDir(fsys, ".", func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		data, err := fs.ReadFile(fsys, path)
+		if err != nil {
+			return err
+		}
+		w, err := zw.CreateHeader(&zip.FileHeader{Name: path, Method: zip.Deflate})
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(data)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return archive.Bytes(), nil
+}
+
+// artifactName reads the Bundle-Name of the iflow manifest, it defaults to the iflow id.
+func artifactName(fsys fs.FS, iflow Iflow) string {
+	manifest, err := fs.ReadFile(fsys, manifestPath)
+	if err != nil {
+		return iflow.ID
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(manifest))
+	for scanner.Scan() {
+		if name, ok := strings.CutPrefix(scanner.Text(), "Bundle-Name:"); ok && strings.TrimSpace(name) != "" {
+			return strings.TrimSpace(name)
+		}
+	}
+	return iflow.ID
+}
+
+// uploadArtifact zips the iflow directory and replaces the design-time artifact with it.
+func uploadArtifact(ctx context.Context, client IBTPClient, fsys fs.FS, iflow Iflow) error {
+	content, err := ZipArtifact(fsys)
+	if err != nil {
+		return err
+	}
+	return client.UpdateIflowArtifact(ctx, artifactName(fsys, iflow), content, iflow)
+}
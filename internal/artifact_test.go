@@ -0,0 +1,62 @@
+package internal
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestZipArtifact(t *testing.T) {
+	t.Run("MissingManifest", func(t *testing.T) {
+		_, err := ZipArtifact(fstest.MapFS{"src/main/resources/script/a.groovy": {Data: []byte(`a`)}})
+		require.ErrorIs(t, err, ErrInvalidArtifact)
+	})
+	t.Run("Valid", func(t *testing.T) {
+		content, err := ZipArtifact(fstest.MapFS{
+			"src/main/resources/script/b.groovy":                 {Data: []byte(`b`)},
+			"src/main/resources/scenarioflows/integrationflow/x": {Data: []byte(`<iflow/>`)},
+			"META-INF/MANIFEST.MF":                               {Data: []byte("Bundle-Name: My Iflow\n")},
+		})
+		require.NoError(t, err)
+		zr, err := zip.NewReader(bytes.NewReader(content), int64(len(content)))
+		require.NoError(t, err)
+		var names []string
+		for _, f := range zr.File {
+			names = append(names, f.Name)
+		}
+		require.Equal(t, []string{"META-INF/MANIFEST.MF", "src/main/resources/scenarioflows/integrationflow/x", "src/main/resources/script/b.groovy"}, names)
+		r, err := zr.File[2].Open()
+		require.NoError(t, err)
+		data, _ := io.ReadAll(r)
+		require.Equal(t, "b", string(data))
+	})
+}
+
+func TestArtifactName(t *testing.T) {
+	require.Equal(t, "My Iflow", artifactName(fstest.MapFS{manifestPath: {Data: []byte("Manifest-Version: 1.0\r\nBundle-Name: My Iflow\r\n")}}, Iflow{ID: "iflow1"}))
+	require.Equal(t, "iflow1", artifactName(fstest.MapFS{manifestPath: {Data: []byte("Manifest-Version: 1.0\n")}}, Iflow{ID: "iflow1"}))
+	require.Equal(t, "iflow1", artifactName(fstest.MapFS{}, Iflow{ID: "iflow1"}))
+}
+
+func TestUploadScriptsArtifact(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "META-INF"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, manifestPath), []byte("Bundle-Name: Iflow One\n"), 0o644))
+
+	mockedClient := BTPClientMock{updateIflowResourceErrors: []error{nil}}
+	err := UploadScripts(t.Context(), &mockedClient, func(string) ([]byte, error) {
+		return []byte(`data`), nil
+	}, []Iflow{
+		{ID: "iflow1", Version: "active", Path: dir, Scripts: []Script{{ID: "script1", Path: "path1"}}},
+		{ID: "iflow2", Version: "active", Path: t.TempDir()},
+	}, UploadOptions{})
+	require.ErrorContains(t, err, "some reading/uploading")
+	require.Equal(t, []string{"Iflow One"}, mockedClient.artifactNames)
+	require.Empty(t, mockedClient.updateIflowResourceErrors)
+}
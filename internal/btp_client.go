@@ -2,22 +2,38 @@ package internal
 
 import (
 	"bytes"
+	"context"
 	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"net/http/cookiejar"
+	"strings"
+	"sync"
+	"time"
 )
 
 const (
-	tokenURLGrantType = "%s?grant_type=client_credentials"
-	updateScriptURL   = "%s/api/v1/IntegrationDesigntimeArtifacts(Id='%s',Version='%s')/$links/Resources(Name='%s',ResourceType='%s')"
-	fetchCSRFTokenURL = "%s/api/v1/"
-	contentType       = "Content-Type"
-	applicationJSON   = "application/json"
-	xcsrfToken        = "x-csrf-token"
-	xcsrfFetch        = "fetch"
+	tokenURLGrantType  = "%s?grant_type=client_credentials"
+	updateScriptURL    = "%s/api/v1/IntegrationDesigntimeArtifacts(Id='%s',Version='%s')/$links/Resources(Name='%s',ResourceType='%s')"
+	readScriptURL      = "%s/api/v1/IntegrationDesigntimeArtifacts(Id='%s',Version='%s')/Resources(Name='%s',ResourceType='%s')/$value"
+	artifactURL        = "%s/api/v1/IntegrationDesigntimeArtifacts(Id='%s',Version='%s')"
+	resourcesURL       = "%s/api/v1/IntegrationDesigntimeArtifacts(Id='%s',Version='%s')/Resources"
+	fetchCSRFTokenURL  = "%s/api/v1/"
+	deployIflowURL     = "%s/api/v1/DeployIntegrationDesigntimeArtifact?Id='%s'&Version='%s'"
+	runtimeArtifactURL = "%s/api/v1/IntegrationRuntimeArtifacts('%s')"
+	runtimeErrorURL    = "%s/api/v1/IntegrationRuntimeArtifacts('%s')/ErrorInformation/$value"
+	contentType        = "Content-Type"
+	accept             = "Accept"
+	applicationJSON    = "application/json"
+	xcsrfToken         = "x-csrf-token"
+	xcsrfFetch         = "fetch"
+	xcsrfRequired      = "required"
+
+	// tokenExpiryMargin renews the access token before it expires during a call.
+	tokenExpiryMargin = time.Minute
 )
 
 var (
@@ -25,22 +41,62 @@ var (
 	ErrEmptyAccessToken     = errors.New("empty access token")
 	ErrNoAccessToken        = errors.New("no access token")
 	ErrNoCSRFToken          = errors.New("no csrf token")
+	ErrArtifactNotFound     = errors.New("artifact not found")
+	ErrResourceNotFound     = errors.New("resource not found")
+)
+
+const (
+	// Runtime artifact statuses reported by IntegrationRuntimeArtifacts.
+	RuntimeStatusStarted = "STARTED"
+	RuntimeStatusError   = "ERROR"
 )
 
+// NewBTPClient creates a client managing its own cookie jar,
+// httpClient should not have a cookie jar of its own.
 func NewBTPClient(httpClient httpClient, tokenURL, apiURL, clientID, clientSecret string) *BTPClient {
+	// cookiejar.New never fails without options.
+	jar, _ := cookiejar.New(nil)
 	return &BTPClient{
 		tokenURL:     tokenURL,
 		apiURL:       apiURL,
 		clientID:     clientID,
 		clientSecret: clientSecret,
 		hc:           httpClient,
+		jar:          jar,
+		now:          time.Now,
+		retry:        DefaultRetryPolicy,
 	}
 }
 
 type IBTPClient interface {
-	RequestToken() error
-	FetchCSRFToken() error
-	UpdateIflowResource(data []byte, iflow Iflow, script Script) error
+	RequestToken(ctx context.Context) error
+	FetchCSRFToken(ctx context.Context) error
+	UpdateIflowResource(ctx context.Context, data []byte, iflow Iflow, script Script) error
+	UpdateIflowArtifact(ctx context.Context, name string, content []byte, iflow Iflow) error
+	GetIflowResource(ctx context.Context, iflow Iflow, script Script) ([]byte, error)
+	DownloadIflowArtifact(ctx context.Context, iflow Iflow) ([]byte, error)
+	ListIflowResources(ctx context.Context, iflow Iflow) ([]Resource, error)
+	DeleteIflowResource(ctx context.Context, iflow Iflow, resource Resource) error
+	DeployIflow(ctx context.Context, iflow Iflow) error
+	GetRuntimeArtifact(ctx context.Context, id string) (RuntimeArtifact, error)
+	GetRuntimeArtifactError(ctx context.Context, id string) (string, error)
+}
+
+// Resource is a resource of an iflow design-time artifact.
+type Resource struct {
+	Name         string `json:"Name"`
+	ResourceType string `json:"ResourceType"`
+}
+
+// RuntimeArtifact is the deployed state of an integration artifact.
+type RuntimeArtifact struct {
+	ID         string `json:"Id"`
+	Version    string `json:"Version"`
+	Name       string `json:"Name"`
+	Type       string `json:"Type"`
+	DeployedBy string `json:"DeployedBy"`
+	DeployedOn string `json:"DeployedOn"`
+	Status     string `json:"Status"`
 }
 
 type httpClient interface {
@@ -53,37 +109,74 @@ type BTPClient struct {
 	clientID     string
 	clientSecret string
 	accessToken  string
-	csrfToken    string
+	// tokenExpiry is zero when the token server does not tell the token lifetime.
+	tokenExpiry time.Time
+	csrfToken   string
+	// mu guards the tokens, it is held while they are renewed.
+	mu sync.Mutex
 
 	hc httpClient
+	// jar keeps the session cookies the csrf token is bound to, whatever hc is.
+	jar http.CookieJar
+	now func() time.Time
+	// retry applies to every request sent, a zero policy sends them once.
+	retry RetryPolicy
+	// sleep replaces the wait between two attempts when set.
+	sleep func(time.Duration)
 }
 
-func (c *BTPClient) RequestToken() error {
-	req, err := buildOauth2AuthRequest(c.tokenURL, c.clientID, c.clientSecret)
+// SetRetryPolicy sets the policy of the transient failures, zero fields take the default value.
+func (c *BTPClient) SetRetryPolicy(policy RetryPolicy) {
+	c.retry = policy.withDefaults()
+}
+
+// RequestToken requests a new access token, the csrf token bound to the previous one is dropped.
+func (c *BTPClient) RequestToken(ctx context.Context) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.requestToken(ctx)
+}
+
+// requestToken is RequestToken, the caller holds c.mu.
+func (c *BTPClient) requestToken(ctx context.Context) error {
+	req, err := buildOauth2AuthRequest(ctx, c.tokenURL, c.clientID, c.clientSecret)
 	if err != nil {
 		return err
 	}
-	res, err := c.hc.Do(req)
+	res, err := c.send(req)
 	if err != nil {
 		return err
 	}
-	accessToken, err := getAccessTokenFromResponse(res)
+	accessToken, expiresIn, err := getAccessTokenFromResponse(res)
 	if err != nil {
 		return err
 	}
 	c.accessToken = accessToken
+	c.tokenExpiry = time.Time{}
+	if expiresIn > 0 {
+		c.tokenExpiry = c.currentTime().Add(expiresIn)
+	}
+	c.csrfToken = ""
 	return nil
 }
 
-func (c *BTPClient) FetchCSRFToken() error {
-	if c.accessToken == "" {
-		return fmt.Errorf("%w: request access token first", ErrNoAccessToken)
+// FetchCSRFToken fetches a new csrf token, an access token is requested first when needed.
+func (c *BTPClient) FetchCSRFToken(ctx context.Context) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.fetchCSRFToken(ctx)
+}
+
+// fetchCSRFToken is FetchCSRFToken, the caller holds c.mu.
+func (c *BTPClient) fetchCSRFToken(ctx context.Context) error {
+	if err := c.ensureAccessToken(ctx); err != nil {
+		return err
 	}
-	req, err := buildFetchCSRFRequest(c.apiURL, c.accessToken)
+	req, err := buildFetchCSRFRequest(ctx, c.apiURL, c.accessToken)
 	if err != nil {
 		return err
 	}
-	res, err := c.hc.Do(req)
+	res, err := c.send(req)
 	if err != nil {
 		return err
 	}
@@ -98,23 +191,188 @@ func (c *BTPClient) FetchCSRFToken() error {
 	return nil
 }
 
-func (c *BTPClient) UpdateIflowResource(data []byte, iflow Iflow, script Script) error {
-	if c.accessToken == "" {
-		return fmt.Errorf("%w: request access token first", ErrNoAccessToken)
+func (c *BTPClient) currentTime() time.Time {
+	if c.now == nil {
+		return time.Now()
 	}
-	if c.csrfToken == "" {
-		return fmt.Errorf("%w: request csrf token first", ErrNoCSRFToken)
+	return c.now()
+}
+
+// ensureAccessToken requests an access token when there is none or when it is about to expire.
+// The caller holds c.mu.
+func (c *BTPClient) ensureAccessToken(ctx context.Context) error {
+	if c.accessToken != "" && (c.tokenExpiry.IsZero() || c.currentTime().Add(tokenExpiryMargin).Before(c.tokenExpiry)) {
+		return nil
 	}
-	payload := fmt.Sprintf("{\"ResourceContent\": \"%s\"}", base64.StdEncoding.EncodeToString(data))
-	request, err := buildUpdateResourceRequest(c.apiURL, iflow, script, []byte(payload), c.accessToken, c.csrfToken)
-	if err != nil {
+	if err := c.requestToken(ctx); err != nil {
+		return fmt.Errorf("RequestToken: %w", err)
+	}
+	return nil
+}
+
+// ensureCSRFToken fetches a csrf token when there is none.
+// The caller holds c.mu.
+func (c *BTPClient) ensureCSRFToken(ctx context.Context) error {
+	if err := c.ensureAccessToken(ctx); err != nil {
 		return err
 	}
+	if c.csrfToken != "" {
+		return nil
+	}
+	if err := c.fetchCSRFToken(ctx); err != nil {
+		return fmt.Errorf("FetchCSRFToken: %w", err)
+	}
+	return nil
+}
+
+// tokens returns valid tokens, the csrf token is only ensured for modifying requests.
+func (c *BTPClient) tokens(ctx context.Context, modifying bool) (string, string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ensure := c.ensureAccessToken
+	if modifying {
+		ensure = c.ensureCSRFToken
+	}
+	if err := ensure(ctx); err != nil {
+		return "", "", err
+	}
+	return c.accessToken, c.csrfToken, nil
+}
+
+// invalidate drops the rejected tokens, unless a concurrent call already renewed them.
+func (c *BTPClient) invalidate(accessToken, csrfToken string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if accessToken != "" && c.accessToken == accessToken {
+		c.accessToken = ""
+	}
+	if csrfToken != "" && c.csrfToken == csrfToken {
+		c.csrfToken = ""
+	}
+}
+
+// do sends the request built with the current tokens, modifying requests also carry a csrf token.
+// On 401 the access token is renewed and the request sent once more,
+// on 403 with a required csrf token the csrf token is renewed and the request sent once more.
+// It is safe for concurrent use.
+func (c *BTPClient) do(ctx context.Context, modifying bool, build func(accessToken, csrfToken string) (*http.Request, error)) (*http.Response, error) {
+	renewedAccessToken, renewedCSRFToken := false, false
+	for {
+		accessToken, csrfToken, err := c.tokens(ctx, modifying)
+		if err != nil {
+			return nil, err
+		}
+		request, err := build(accessToken, csrfToken)
+		if err != nil {
+			return nil, err
+		}
+		res, err := c.send(request)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case res.StatusCode == http.StatusUnauthorized && !renewedAccessToken:
+			renewedAccessToken = true
+			c.invalidate(accessToken, "")
+		case res.StatusCode == http.StatusForbidden && modifying && !renewedCSRFToken && strings.EqualFold(res.Header.Get(xcsrfToken), xcsrfRequired):
+			renewedCSRFToken = true
+			c.invalidate("", csrfToken)
+		default:
+			return res, nil
+		}
+		closeBody(res)
+	}
+}
+
+// send sends the request, retrying it on transient failures according to the retry policy.
+func (c *BTPClient) send(request *http.Request) (*http.Response, error) {
+	start := c.currentTime()
+	for attempt := 1; ; attempt++ {
+		res, err := c.sendOnce(request)
+		if attempt >= c.retry.MaxAttempts || request.Context().Err() != nil || !retryable(request.Method, res, err) {
+			return res, err
+		}
+		delay := c.retry.backoff(attempt)
+		if after, ok := retryAfter(res, c.currentTime()); ok {
+			delay = after
+		}
+		if c.retry.Deadline > 0 && c.currentTime().Add(delay).Sub(start) > c.retry.Deadline {
+			return res, err
+		}
+		if request.GetBody != nil {
+			body, bodyErr := request.GetBody()
+			if bodyErr != nil {
+				return res, err
+			}
+			request.Body = body
+		}
+		if res != nil {
+			closeBody(res)
+		}
+		if err := c.wait(request.Context(), delay); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// wait sleeps for delay, or until ctx is done.
+func (c *BTPClient) wait(ctx context.Context, delay time.Duration) error {
+	if c.sleep != nil {
+		c.sleep(delay)
+		return ctx.Err()
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// sendOnce sends the request with the session cookies of the jar, then stores the returned ones.
+func (c *BTPClient) sendOnce(request *http.Request) (*http.Response, error) {
+	// a retried request carries the cookies of the jar only.
+	request.Header.Del("Cookie")
+	if c.jar != nil {
+		for _, cookie := range c.jar.Cookies(request.URL) {
+			request.AddCookie(cookie)
+		}
+	}
 	res, err := c.hc.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	if c.jar != nil {
+		if cookies := res.Cookies(); len(cookies) > 0 {
+			c.jar.SetCookies(request.URL, cookies)
+		}
+	}
+	return res, nil
+}
+
+func closeBody(res *http.Response) {
+	if res.Body != nil {
+		io.Copy(io.Discard, res.Body)
+		res.Body.Close()
+	}
+}
+
+func (c *BTPClient) UpdateIflowResource(ctx context.Context, data []byte, iflow Iflow, script Script) error {
+	payload := fmt.Sprintf("{\"ResourceContent\": \"%s\"}", base64.StdEncoding.EncodeToString(data))
+	res, err := c.do(ctx, true, func(accessToken, csrfToken string) (*http.Request, error) {
+		return buildUpdateResourceRequest(ctx, c.apiURL, iflow, script, []byte(payload), accessToken, csrfToken)
+	})
 	if err != nil {
 		return err
 	}
 
+	// the resource does not exist yet in the iflow, it is created instead.
+	if res.StatusCode == http.StatusNotFound {
+		closeBody(res)
+		return c.createIflowResource(ctx, data, iflow, script)
+	}
 	if res.StatusCode != http.StatusOK && res.StatusCode != http.StatusCreated {
 		body, _ := io.ReadAll(res.Body)
 		return fmt.Errorf("%w - %s", ErrUnexpectedStatusCode, body)
@@ -122,10 +380,166 @@ func (c *BTPClient) UpdateIflowResource(data []byte, iflow Iflow, script Script)
 	return nil
 }
 
+func (c *BTPClient) createIflowResource(ctx context.Context, data []byte, iflow Iflow, script Script) error {
+	payload, err := json.Marshal(map[string]string{
+		"Name":            script.ID,
+		"ResourceType":    script.Type,
+		"ResourceContent": base64.StdEncoding.EncodeToString(data),
+	})
+	if err != nil {
+		return err
+	}
+	res, err := c.do(ctx, true, func(accessToken, csrfToken string) (*http.Request, error) {
+		return buildCreateResourceRequest(ctx, c.apiURL, iflow, payload, accessToken, csrfToken)
+	})
+	if err != nil {
+		return err
+	}
+	if res.StatusCode != http.StatusOK && res.StatusCode != http.StatusCreated {
+		body, _ := io.ReadAll(res.Body)
+		return fmt.Errorf("%w - %s", ErrUnexpectedStatusCode, body)
+	}
+	return nil
+}
+
+// UpdateIflowArtifact replaces the whole iflow design-time artifact by the zipped content.
+func (c *BTPClient) UpdateIflowArtifact(ctx context.Context, name string, content []byte, iflow Iflow) error {
+	payload, err := json.Marshal(map[string]string{
+		"Name":            name,
+		"ArtifactContent": base64.StdEncoding.EncodeToString(content),
+	})
+	if err != nil {
+		return err
+	}
+	res, err := c.do(ctx, true, func(accessToken, csrfToken string) (*http.Request, error) {
+		return buildUpdateArtifactRequest(ctx, c.apiURL, iflow, payload, accessToken, csrfToken)
+	})
+	if err != nil {
+		return err
+	}
+	if res.StatusCode != http.StatusOK && res.StatusCode != http.StatusAccepted && res.StatusCode != http.StatusNoContent {
+		body, _ := io.ReadAll(res.Body)
+		return fmt.Errorf("%w - %s", ErrUnexpectedStatusCode, body)
+	}
+	return nil
+}
+
+// GetIflowResource reads the content of an iflow resource.
+func (c *BTPClient) GetIflowResource(ctx context.Context, iflow Iflow, script Script) ([]byte, error) {
+	res, err := c.do(ctx, false, func(accessToken, csrfToken string) (*http.Request, error) {
+		return buildGetResourceRequest(ctx, c.apiURL, iflow, script, accessToken)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode == http.StatusNotFound {
+		return nil, fmt.Errorf("%w: %s", ErrResourceNotFound, script.ID)
+	}
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%w - %d %s", ErrUnexpectedStatusCode, res.StatusCode, body)
+	}
+	return body, nil
+}
+
+// DownloadIflowArtifact downloads the zipped iflow design-time artifact.
+func (c *BTPClient) DownloadIflowArtifact(ctx context.Context, iflow Iflow) ([]byte, error) {
+	res, err := c.do(ctx, false, func(accessToken, csrfToken string) (*http.Request, error) {
+		return buildDownloadArtifactRequest(ctx, c.apiURL, iflow, accessToken)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode == http.StatusNotFound {
+		return nil, fmt.Errorf("%w: %s", ErrArtifactNotFound, iflow.ID)
+	}
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%w - %d %s", ErrUnexpectedStatusCode, res.StatusCode, body)
+	}
+	return body, nil
+}
+
+// ListIflowResources lists the resources of an iflow.
+func (c *BTPClient) ListIflowResources(ctx context.Context, iflow Iflow) ([]Resource, error) {
+	res, err := c.do(ctx, false, func(accessToken, csrfToken string) (*http.Request, error) {
+		return buildListResourcesRequest(ctx, c.apiURL, iflow, accessToken)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return getResourcesFromResponse(res)
+}
+
+// DeleteIflowResource removes a resource from the iflow.
+func (c *BTPClient) DeleteIflowResource(ctx context.Context, iflow Iflow, resource Resource) error {
+	res, err := c.do(ctx, true, func(accessToken, csrfToken string) (*http.Request, error) {
+		return buildDeleteResourceRequest(ctx, c.apiURL, iflow, resource, accessToken, csrfToken)
+	})
+	if err != nil {
+		return err
+	}
+	if res.StatusCode != http.StatusOK && res.StatusCode != http.StatusNoContent {
+		body, _ := io.ReadAll(res.Body)
+		return fmt.Errorf("%w - %s", ErrUnexpectedStatusCode, body)
+	}
+	return nil
+}
+
+// DeployIflow triggers the deployment of the iflow design-time artifact.
+func (c *BTPClient) DeployIflow(ctx context.Context, iflow Iflow) error {
+	res, err := c.do(ctx, true, func(accessToken, csrfToken string) (*http.Request, error) {
+		return buildDeployIflowRequest(ctx, c.apiURL, iflow, accessToken, csrfToken)
+	})
+	if err != nil {
+		return err
+	}
+	if res.StatusCode != http.StatusOK && res.StatusCode != http.StatusAccepted {
+		body, _ := io.ReadAll(res.Body)
+		return fmt.Errorf("%w - %s", ErrUnexpectedStatusCode, body)
+	}
+	return nil
+}
+
+// GetRuntimeArtifact reads the runtime state of a deployed artifact.
+func (c *BTPClient) GetRuntimeArtifact(ctx context.Context, id string) (RuntimeArtifact, error) {
+	res, err := c.do(ctx, false, func(accessToken, csrfToken string) (*http.Request, error) {
+		return buildGetRuntimeArtifactRequest(ctx, c.apiURL, id, accessToken)
+	})
+	if err != nil {
+		return RuntimeArtifact{}, err
+	}
+	return getRuntimeArtifactFromResponse(res)
+}
+
+// GetRuntimeArtifactError reads the error information of an artifact in error.
+func (c *BTPClient) GetRuntimeArtifactError(ctx context.Context, id string) (string, error) {
+	res, err := c.do(ctx, false, func(accessToken, csrfToken string) (*http.Request, error) {
+		return buildGetRuntimeErrorRequest(ctx, c.apiURL, id, accessToken)
+	})
+	if err != nil {
+		return "", err
+	}
+	if res.StatusCode == http.StatusNotFound {
+		return "", ErrArtifactNotFound
+	}
+	body, _ := io.ReadAll(res.Body)
+	if res.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("%w - %d %s", ErrUnexpectedStatusCode, res.StatusCode, body)
+	}
+	return string(body), nil
+}
+
 // buildOauth2AuthRequest creates http request with BasicAuth authentication.
-func buildOauth2AuthRequest(tokenURL, clientID, clientSecret string) (*http.Request, error) {
+func buildOauth2AuthRequest(ctx context.Context, tokenURL, clientID, clientSecret string) (*http.Request, error) {
 	url := fmt.Sprintf(tokenURLGrantType, tokenURL)
-	request, err := http.NewRequest(http.MethodPost, url, nil)
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, url, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -135,25 +549,27 @@ func buildOauth2AuthRequest(tokenURL, clientID, clientSecret string) (*http.Requ
 }
 
 // getAccessTokenFromResponse checks response Status Code and read response Body.
-func getAccessTokenFromResponse(res *http.Response) (string, error) {
+// The returned lifetime is zero when the response has no expires_in.
+func getAccessTokenFromResponse(res *http.Response) (string, time.Duration, error) {
 	if res.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("%w - %d", ErrUnexpectedStatusCode, res.StatusCode)
+		return "", 0, fmt.Errorf("%w - %d", ErrUnexpectedStatusCode, res.StatusCode)
 	}
 	body, _ := io.ReadAll(res.Body)
 	m := map[string]any{}
 	err := json.Unmarshal(body, &m)
 	if err != nil {
-		return "", err
+		return "", 0, err
 	}
 	accessToken, ok := m["access_token"].(string)
 	if !ok {
-		return "", ErrEmptyAccessToken
+		return "", 0, ErrEmptyAccessToken
 	}
-	return accessToken, nil
+	expiresIn, _ := m["expires_in"].(float64)
+	return accessToken, time.Duration(expiresIn) * time.Second, nil
 }
 
-func buildFetchCSRFRequest(apiURL, accessToken string) (*http.Request, error) {
-	request, err := http.NewRequest(http.MethodGet, fmt.Sprintf(fetchCSRFTokenURL, apiURL), nil)
+func buildFetchCSRFRequest(ctx context.Context, apiURL, accessToken string) (*http.Request, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf(fetchCSRFTokenURL, apiURL), nil)
 	if err != nil {
 		return nil, err
 	}
@@ -162,9 +578,21 @@ func buildFetchCSRFRequest(apiURL, accessToken string) (*http.Request, error) {
 	return request, nil
 }
 
-func buildUpdateResourceRequest(apiURL string, iflow Iflow, script Script, payload []byte, accessToken, token string) (*http.Request, error) {
+func buildUpdateResourceRequest(ctx context.Context, apiURL string, iflow Iflow, script Script, payload []byte, accessToken, token string) (*http.Request, error) {
 	url := fmt.Sprintf(updateScriptURL, apiURL, iflow.ID, iflow.Version, script.ID, script.Type)
-	request, err := http.NewRequest(http.MethodPut, url, bytes.NewReader([]byte(payload)))
+	request, err := http.NewRequestWithContext(ctx, http.MethodPut, url, bytes.NewReader([]byte(payload)))
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Add(contentType, applicationJSON)
+	request.Header.Add(xcsrfToken, token)
+	request.Header.Add("Authorization", fmt.Sprintf("Bearer %s", accessToken))
+	return request, nil
+}
+
+func buildUpdateArtifactRequest(ctx context.Context, apiURL string, iflow Iflow, payload []byte, accessToken, token string) (*http.Request, error) {
+	url := fmt.Sprintf(artifactURL, apiURL, iflow.ID, iflow.Version)
+	request, err := http.NewRequestWithContext(ctx, http.MethodPut, url, bytes.NewReader(payload))
 	if err != nil {
 		return nil, err
 	}
@@ -173,3 +601,126 @@ func buildUpdateResourceRequest(apiURL string, iflow Iflow, script Script, paylo
 	request.Header.Add("Authorization", fmt.Sprintf("Bearer %s", accessToken))
 	return request, nil
 }
+
+func buildDownloadArtifactRequest(ctx context.Context, apiURL string, iflow Iflow, accessToken string) (*http.Request, error) {
+	url := fmt.Sprintf(artifactURL, apiURL, iflow.ID, iflow.Version) + "/$value"
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Add("Authorization", fmt.Sprintf("Bearer %s", accessToken))
+	return request, nil
+}
+
+func buildCreateResourceRequest(ctx context.Context, apiURL string, iflow Iflow, payload []byte, accessToken, token string) (*http.Request, error) {
+	url := fmt.Sprintf(resourcesURL, apiURL, iflow.ID, iflow.Version)
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Add(contentType, applicationJSON)
+	request.Header.Add(xcsrfToken, token)
+	request.Header.Add("Authorization", fmt.Sprintf("Bearer %s", accessToken))
+	return request, nil
+}
+
+func buildDeleteResourceRequest(ctx context.Context, apiURL string, iflow Iflow, resource Resource, accessToken, token string) (*http.Request, error) {
+	url := fmt.Sprintf(updateScriptURL, apiURL, iflow.ID, iflow.Version, resource.Name, resource.ResourceType)
+	request, err := http.NewRequestWithContext(ctx, http.MethodDelete, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Add(xcsrfToken, token)
+	request.Header.Add("Authorization", fmt.Sprintf("Bearer %s", accessToken))
+	return request, nil
+}
+
+func buildGetResourceRequest(ctx context.Context, apiURL string, iflow Iflow, script Script, accessToken string) (*http.Request, error) {
+	url := fmt.Sprintf(readScriptURL, apiURL, iflow.ID, iflow.Version, script.ID, script.Type)
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Add("Authorization", fmt.Sprintf("Bearer %s", accessToken))
+	return request, nil
+}
+
+func buildListResourcesRequest(ctx context.Context, apiURL string, iflow Iflow, accessToken string) (*http.Request, error) {
+	url := fmt.Sprintf(resourcesURL, apiURL, iflow.ID, iflow.Version)
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Add(accept, applicationJSON)
+	request.Header.Add("Authorization", fmt.Sprintf("Bearer %s", accessToken))
+	return request, nil
+}
+
+// getResourcesFromResponse checks response Status Code and decodes the OData collection.
+func getResourcesFromResponse(res *http.Response) ([]Resource, error) {
+	if res.StatusCode == http.StatusNotFound {
+		return nil, ErrArtifactNotFound
+	}
+	body, _ := io.ReadAll(res.Body)
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%w - %d %s", ErrUnexpectedStatusCode, res.StatusCode, body)
+	}
+	var collection struct {
+		D struct {
+			Results []Resource `json:"results"`
+		} `json:"d"`
+	}
+	if err := json.Unmarshal(body, &collection); err != nil {
+		return nil, err
+	}
+	return collection.D.Results, nil
+}
+
+func buildDeployIflowRequest(ctx context.Context, apiURL string, iflow Iflow, accessToken, token string) (*http.Request, error) {
+	url := fmt.Sprintf(deployIflowURL, apiURL, iflow.ID, iflow.Version)
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Add(xcsrfToken, token)
+	request.Header.Add("Authorization", fmt.Sprintf("Bearer %s", accessToken))
+	return request, nil
+}
+
+func buildGetRuntimeArtifactRequest(ctx context.Context, apiURL, id, accessToken string) (*http.Request, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf(runtimeArtifactURL, apiURL, id), nil)
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Add(accept, applicationJSON)
+	request.Header.Add("Authorization", fmt.Sprintf("Bearer %s", accessToken))
+	return request, nil
+}
+
+// getRuntimeArtifactFromResponse checks response Status Code and decodes the OData entity.
+func getRuntimeArtifactFromResponse(res *http.Response) (RuntimeArtifact, error) {
+	if res.StatusCode == http.StatusNotFound {
+		return RuntimeArtifact{}, ErrArtifactNotFound
+	}
+	if res.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(res.Body)
+		return RuntimeArtifact{}, fmt.Errorf("%w - %d %s", ErrUnexpectedStatusCode, res.StatusCode, body)
+	}
+	body, _ := io.ReadAll(res.Body)
+	var entity struct {
+		D RuntimeArtifact `json:"d"`
+	}
+	if err := json.Unmarshal(body, &entity); err != nil {
+		return RuntimeArtifact{}, err
+	}
+	return entity.D, nil
+}
+
+func buildGetRuntimeErrorRequest(ctx context.Context, apiURL, id, accessToken string) (*http.Request, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf(runtimeErrorURL, apiURL, id), nil)
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Add("Authorization", fmt.Sprintf("Bearer %s", accessToken))
+	return request, nil
+}
@@ -2,11 +2,15 @@ package internal
 
 import (
 	"bytes"
+	"context"
 	"encoding/base64"
 	"fmt"
 	"io"
 	"net/http"
+	"net/http/httptest"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 )
@@ -20,9 +24,9 @@ const (
 )
 
 func TestBuildOauth2AuthRequest(t *testing.T) {
-	_, err := buildOauth2AuthRequest("://bad-url", "clientid", "clientsecret")
+	_, err := buildOauth2AuthRequest(t.Context(), "://bad-url", "clientid", "clientsecret")
 	require.Error(t, err)
-	request, err := buildOauth2AuthRequest("https://itevia.com/oauth/token", "clientid", "clientsecret")
+	request, err := buildOauth2AuthRequest(t.Context(), "https://itevia.com/oauth/token", "clientid", "clientsecret")
 	require.Nil(t, err)
 	require.Equal(t, "/oauth/token?grant_type=client_credentials", request.URL.RequestURI())
 	require.Equal(t, fmt.Sprintf("Basic %s", base64.StdEncoding.EncodeToString([]byte("clientid:clientsecret"))), request.Header.Get("Authorization"))
@@ -30,9 +34,9 @@ func TestBuildOauth2AuthRequest(t *testing.T) {
 }
 
 func TestBuildFetchCSRFRequest(t *testing.T) {
-	_, err := buildFetchCSRFRequest("://bad-url", "myaccesstoken")
+	_, err := buildFetchCSRFRequest(t.Context(), "://bad-url", "myaccesstoken")
 	require.Error(t, err)
-	request, err := buildFetchCSRFRequest("https://itevia.com", "myaccesstoken")
+	request, err := buildFetchCSRFRequest(t.Context(), "https://itevia.com", "myaccesstoken")
 	require.Nil(t, err)
 	require.Equal(t, "/api/v1/", request.URL.RequestURI())
 	require.Equal(t, "Bearer myaccesstoken", request.Header.Get("Authorization"))
@@ -40,9 +44,9 @@ func TestBuildFetchCSRFRequest(t *testing.T) {
 }
 
 func TestBuildUpdateResourceRequest(t *testing.T) {
-	_, err := buildUpdateResourceRequest("://bad-url", Iflow{ID: "iflowid", Version: "iflowversion"}, Script{ID: "scriptid", Type: "scripttype", Path: "scriptpath"}, []byte("{\"a\":\"b\"}"), "myaccesstoken", "myxscrftoken")
+	_, err := buildUpdateResourceRequest(t.Context(), "://bad-url", Iflow{ID: "iflowid", Version: "iflowversion"}, Script{ID: "scriptid", Type: "scripttype", Path: "scriptpath"}, []byte("{\"a\":\"b\"}"), "myaccesstoken", "myxscrftoken")
 	require.Error(t, err)
-	request, err := buildUpdateResourceRequest("https://api.itevia.com", Iflow{ID: "iflowid", Version: "iflowversion"}, Script{ID: "scriptid", Type: "scripttype", Path: "scriptpath"}, []byte("{\"a\":\"b\"}"), "myaccesstoken", "myxscrftoken")
+	request, err := buildUpdateResourceRequest(t.Context(), "https://api.itevia.com", Iflow{ID: "iflowid", Version: "iflowversion"}, Script{ID: "scriptid", Type: "scripttype", Path: "scriptpath"}, []byte("{\"a\":\"b\"}"), "myaccesstoken", "myxscrftoken")
 	require.Nil(t, err)
 	require.Equal(t, "/api/v1/IntegrationDesigntimeArtifacts(Id='iflowid',Version='iflowversion')/$links/Resources(Name='scriptid',ResourceType='scripttype')", request.URL.RequestURI())
 	require.Equal(t, "Bearer myaccesstoken", request.Header.Get("Authorization"))
@@ -51,29 +55,38 @@ func TestBuildUpdateResourceRequest(t *testing.T) {
 }
 
 func TestGetAccessTokenFromResponse(t *testing.T) {
-	_, err := getAccessTokenFromResponse(&http.Response{
+	_, _, err := getAccessTokenFromResponse(&http.Response{
 		StatusCode: http.StatusBadRequest,
 	})
 	require.ErrorIs(t, err, ErrUnexpectedStatusCode)
 
-	_, err = getAccessTokenFromResponse(&http.Response{
+	_, _, err = getAccessTokenFromResponse(&http.Response{
 		StatusCode: http.StatusOK,
 		Body:       io.NopCloser(bytes.NewReader([]byte(`{"a":"b"}`))),
 	})
 	require.ErrorIs(t, err, ErrEmptyAccessToken)
 
-	_, err = getAccessTokenFromResponse(&http.Response{
+	_, _, err = getAccessTokenFromResponse(&http.Response{
 		StatusCode: http.StatusOK,
 		Body:       io.NopCloser(bytes.NewReader([]byte(`{access_token": "myaccesstoken"}`))),
 	})
 	require.Error(t, err)
 
-	accessToken, err := getAccessTokenFromResponse(&http.Response{
+	accessToken, expiresIn, err := getAccessTokenFromResponse(&http.Response{
 		StatusCode: http.StatusOK,
 		Body:       io.NopCloser(bytes.NewReader([]byte(`{"access_token": "myaccesstoken"}`))),
 	})
 	require.NoError(t, err)
 	require.Equal(t, "myaccesstoken", accessToken)
+	require.Zero(t, expiresIn)
+
+	accessToken, expiresIn, err = getAccessTokenFromResponse(&http.Response{
+		StatusCode: http.StatusOK,
+		Body:       io.NopCloser(bytes.NewReader([]byte(`{"access_token": "myaccesstoken", "expires_in": 3600}`))),
+	})
+	require.NoError(t, err)
+	require.Equal(t, "myaccesstoken", accessToken)
+	require.Equal(t, time.Hour, expiresIn)
 }
 
 func TestBTPClientRequestToken(t *testing.T) {
@@ -86,7 +99,7 @@ func TestBTPClientRequestToken(t *testing.T) {
 			clientSecret: "clientsecret",
 			hc:           mockedHTTPClient,
 		}
-		err := client.RequestToken()
+		err := client.RequestToken(t.Context())
 		require.Error(t, err)
 	})
 
@@ -100,7 +113,7 @@ func TestBTPClientRequestToken(t *testing.T) {
 			hc:           mockedHTTPClient,
 		}
 
-		err := client.RequestToken()
+		err := client.RequestToken(t.Context())
 		require.ErrorContains(t, err, "http do failed")
 	})
 
@@ -114,7 +127,7 @@ func TestBTPClientRequestToken(t *testing.T) {
 			hc:           mockedHTTPClient,
 		}
 
-		err := client.RequestToken()
+		err := client.RequestToken(t.Context())
 		require.ErrorIs(t, err, ErrUnexpectedStatusCode)
 	})
 
@@ -128,21 +141,34 @@ func TestBTPClientRequestToken(t *testing.T) {
 			hc:           mockedHTTPClient,
 		}
 
-		require.Nil(t, client.RequestToken())
+		require.Nil(t, client.RequestToken(t.Context()))
 		require.Equal(t, "myaccesstoken", client.accessToken)
 	})
 }
 
 func TestBTPClientUpdateResource(t *testing.T) {
 	t.Run("NoAccessToken", func(t *testing.T) {
-		client := NewBTPClient(nil, ttokenURL, tapiURL, tclientID, tclientSecret)
-		require.ErrorIs(t, client.UpdateIflowResource([]byte(`data`), Iflow{}, Script{}), ErrNoAccessToken)
+		mockedHTTPClient := newMockedHTTPClient([]mockedResponse{
+			tokenResponse("myaccesstoken", 3600),
+			csrfResponse("mycsrftoken"),
+			{res: &http.Response{StatusCode: http.StatusOK}},
+		})
+		client := NewBTPClient(mockedHTTPClient, ttokenURL, tapiURL, tclientID, tclientSecret)
+		require.NoError(t, client.UpdateIflowResource(t.Context(), []byte(`data`), Iflow{}, Script{}))
+		require.Empty(t, mockedHTTPClient.responses)
+	})
+
+	t.Run("FailRequestToken", func(t *testing.T) {
+		mockedHTTPClient := newMockedHTTPClient([]mockedResponse{{res: &http.Response{StatusCode: http.StatusUnauthorized}}})
+		client := NewBTPClient(mockedHTTPClient, ttokenURL, tapiURL, tclientID, tclientSecret)
+		require.ErrorIs(t, client.UpdateIflowResource(t.Context(), []byte(`data`), Iflow{}, Script{}), ErrUnexpectedStatusCode)
 	})
 
 	t.Run("NoCSRFToken", func(t *testing.T) {
-		client := NewBTPClient(nil, ttokenURL, tapiURL, tclientID, tclientSecret)
+		mockedHTTPClient := newMockedHTTPClient([]mockedResponse{{res: &http.Response{StatusCode: http.StatusOK}}})
+		client := NewBTPClient(mockedHTTPClient, ttokenURL, tapiURL, tclientID, tclientSecret)
 		client.accessToken = "myaccesstoken"
-		require.ErrorIs(t, client.UpdateIflowResource([]byte(`data`), Iflow{}, Script{}), ErrNoCSRFToken)
+		require.ErrorIs(t, client.UpdateIflowResource(t.Context(), []byte(`data`), Iflow{}, Script{}), ErrNoCSRFToken)
 	})
 
 	t.Run("FailBuildRequest", func(t *testing.T) {
@@ -150,55 +176,101 @@ func TestBTPClientUpdateResource(t *testing.T) {
 		client := NewBTPClient(mockedHTTPClient, ttokenURL, tapiBadURL, tclientID, tclientSecret)
 		client.accessToken = "myaccesstoken"
 		client.csrfToken = "mycsrftoken"
-		require.Error(t, client.UpdateIflowResource([]byte(`data`), Iflow{}, Script{}))
+		require.Error(t, client.UpdateIflowResource(t.Context(), []byte(`data`), Iflow{}, Script{}))
 	})
 
 	t.Run("FailHttpDo", func(t *testing.T) {
 		mockedHTTPClient := newMockedHTTPClient([]mockedResponse{{err: fmt.Errorf("http do send")}})
 		client := NewBTPClient(mockedHTTPClient, ttokenURL, tapiURL, tclientID, tclientSecret)
+		client.SetRetryPolicy(RetryPolicy{MaxAttempts: 1})
 		client.accessToken = "myaccesstoken"
 		client.csrfToken = "mycsrftoken"
-		require.ErrorContains(t, client.UpdateIflowResource([]byte(`data`), Iflow{ID: "iid", Version: "iversion"}, Script{ID: "sid", Type: "stype"}), "http do send")
+		require.ErrorContains(t, client.UpdateIflowResource(t.Context(), []byte(`data`), Iflow{ID: "iid", Version: "iversion"}, Script{ID: "sid", Type: "stype"}), "http do send")
 	})
 
 	t.Run("FailInvalidResponseStatus", func(t *testing.T) {
 		mockedHTTPClient := newMockedHTTPClient([]mockedResponse{{res: &http.Response{StatusCode: http.StatusBadGateway, Body: io.NopCloser(bytes.NewReader([]byte(`{"message":"error cause"}`)))}}})
 		client := NewBTPClient(mockedHTTPClient, ttokenURL, tapiURL, tclientID, tclientSecret)
+		client.SetRetryPolicy(RetryPolicy{MaxAttempts: 1})
 		client.accessToken = "myaccesstoken"
 		client.csrfToken = "mycsrftoken"
-		require.ErrorIs(t, client.UpdateIflowResource([]byte(`data`), Iflow{ID: "iid", Version: "iversion"}, Script{ID: "sid", Type: "stype"}), ErrUnexpectedStatusCode)
+		require.ErrorIs(t, client.UpdateIflowResource(t.Context(), []byte(`data`), Iflow{ID: "iid", Version: "iversion"}, Script{ID: "sid", Type: "stype"}), ErrUnexpectedStatusCode)
 	})
 	t.Run("Valid", func(t *testing.T) {
 		mockedHTTPClient := newMockedHTTPClient([]mockedResponse{{res: &http.Response{StatusCode: http.StatusCreated}}})
 		client := NewBTPClient(mockedHTTPClient, ttokenURL, tapiURL, tclientID, tclientSecret)
 		client.accessToken = "myaccesstoken"
 		client.csrfToken = "mycsrftoken"
-		require.Nil(t, client.UpdateIflowResource([]byte(`data`), Iflow{ID: "iid", Version: "iversion"}, Script{ID: "sid", Type: "stype"}))
+		require.Nil(t, client.UpdateIflowResource(t.Context(), []byte(`data`), Iflow{ID: "iid", Version: "iversion"}, Script{ID: "sid", Type: "stype"}))
+	})
+	t.Run("CreateMissing", func(t *testing.T) {
+		notFound := &closeRecorder{Reader: bytes.NewReader([]byte(`{"message":"not found"}`))}
+		mockedHTTPClient := newMockedHTTPClient([]mockedResponse{
+			{res: &http.Response{StatusCode: http.StatusNotFound, Body: notFound}},
+			{res: &http.Response{StatusCode: http.StatusCreated}},
+		})
+		client := NewBTPClient(mockedHTTPClient, ttokenURL, tapiURL, tclientID, tclientSecret)
+		client.accessToken = "myaccesstoken"
+		client.csrfToken = "mycsrftoken"
+		require.Nil(t, client.UpdateIflowResource(t.Context(), []byte(`data`), Iflow{ID: "iid", Version: "iversion"}, Script{ID: "sid", Type: "stype"}))
+		require.Empty(t, mockedHTTPClient.responses)
+		require.True(t, notFound.closed)
+	})
+	t.Run("FailCreateMissing", func(t *testing.T) {
+		mockedHTTPClient := newMockedHTTPClient([]mockedResponse{
+			{res: &http.Response{StatusCode: http.StatusNotFound}},
+			{res: &http.Response{StatusCode: http.StatusBadRequest, Body: io.NopCloser(bytes.NewReader([]byte(`{"message":"error cause"}`)))}},
+		})
+		client := NewBTPClient(mockedHTTPClient, ttokenURL, tapiURL, tclientID, tclientSecret)
+		client.accessToken = "myaccesstoken"
+		client.csrfToken = "mycsrftoken"
+		require.ErrorIs(t, client.UpdateIflowResource(t.Context(), []byte(`data`), Iflow{ID: "iid", Version: "iversion"}, Script{ID: "sid", Type: "stype"}), ErrUnexpectedStatusCode)
 	})
 }
 
+func TestBuildCreateResourceRequest(t *testing.T) {
+	_, err := buildCreateResourceRequest(t.Context(), tapiBadURL, Iflow{ID: "iflowid", Version: "iflowversion"}, []byte(`{}`), "myaccesstoken", "myxscrftoken")
+	require.Error(t, err)
+	request, err := buildCreateResourceRequest(t.Context(), tapiURL, Iflow{ID: "iflowid", Version: "iflowversion"}, []byte(`{"Name":"scriptid"}`), "myaccesstoken", "myxscrftoken")
+	require.Nil(t, err)
+	require.Equal(t, http.MethodPost, request.Method)
+	require.Equal(t, "/api/v1/IntegrationDesigntimeArtifacts(Id='iflowid',Version='iflowversion')/Resources", request.URL.RequestURI())
+	require.Equal(t, "Bearer myaccesstoken", request.Header.Get("Authorization"))
+	require.Equal(t, "myxscrftoken", request.Header.Get(xcsrfToken))
+	require.Equal(t, "application/json", request.Header.Get("Content-Type"))
+	body, _ := io.ReadAll(request.Body)
+	require.Equal(t, `{"Name":"scriptid"}`, string(body))
+}
+
 func TestBTPClientFetchCSRFToken(t *testing.T) {
 	t.Run("NoAccessToken", func(t *testing.T) {
+		mockedHTTPClient := newMockedHTTPClient([]mockedResponse{
+			tokenResponse("myaccesstoken", 0),
+			csrfResponse("mycsrftoken"),
+		})
 		client := BTPClient{
 			tokenURL:     "https://itevia.com/oauth/token",
 			apiURL:       "https://api.itevia.com",
 			clientID:     "clientid",
 			clientSecret: "clientsecret",
+			hc:           mockedHTTPClient,
 		}
-		require.ErrorIs(t, client.FetchCSRFToken(), ErrNoAccessToken)
+		require.NoError(t, client.FetchCSRFToken(t.Context()))
+		require.Equal(t, "myaccesstoken", client.accessToken)
+		require.Equal(t, "mycsrftoken", client.csrfToken)
 	})
 
 	t.Run("FailBuildRequest", func(t *testing.T) {
 		mockedHTTPClient := newMockedHTTPClient([]mockedResponse{})
 		client := BTPClient{
-			tokenURL:     "https://itevia.com/oauth/token",
+			tokenURL:     "://bad-url",
 			apiURL:       "https://api.itevia.com",
 			clientID:     "clientid",
 			clientSecret: "clientsecret",
 			accessToken:  "",
 			hc:           mockedHTTPClient,
 		}
-		require.Error(t, client.FetchCSRFToken())
+		require.Error(t, client.FetchCSRFToken(t.Context()))
 	})
 
 	t.Run("FailRequestBuild", func(t *testing.T) {
@@ -211,7 +283,7 @@ func TestBTPClientFetchCSRFToken(t *testing.T) {
 			accessToken:  "myaccesstoken",
 			hc:           mockedHTTPClient,
 		}
-		require.Error(t, client.FetchCSRFToken())
+		require.Error(t, client.FetchCSRFToken(t.Context()))
 	})
 
 	t.Run("FailRequestSend", func(t *testing.T) {
@@ -224,7 +296,7 @@ func TestBTPClientFetchCSRFToken(t *testing.T) {
 			accessToken:  "myaccesstoken",
 			hc:           mockedHTTPClient,
 		}
-		require.ErrorContains(t, client.FetchCSRFToken(), "http do send")
+		require.ErrorContains(t, client.FetchCSRFToken(t.Context()), "http do send")
 	})
 
 	t.Run("InvalidResponse", func(t *testing.T) {
@@ -237,7 +309,7 @@ func TestBTPClientFetchCSRFToken(t *testing.T) {
 			accessToken:  "myaccesstoken",
 			hc:           mockedHTTPClient,
 		}
-		require.ErrorIs(t, client.FetchCSRFToken(), ErrUnexpectedStatusCode)
+		require.ErrorIs(t, client.FetchCSRFToken(t.Context()), ErrUnexpectedStatusCode)
 	})
 
 	t.Run("CSRFNotSet", func(t *testing.T) {
@@ -250,7 +322,7 @@ func TestBTPClientFetchCSRFToken(t *testing.T) {
 			accessToken:  "myaccesstoken",
 			hc:           mockedHTTPClient,
 		}
-		require.ErrorIs(t, client.FetchCSRFToken(), ErrNoCSRFToken)
+		require.ErrorIs(t, client.FetchCSRFToken(t.Context()), ErrNoCSRFToken)
 	})
 
 	t.Run("Valid", func(t *testing.T) {
@@ -260,11 +332,215 @@ func TestBTPClientFetchCSRFToken(t *testing.T) {
 		client := NewBTPClient(mockedHTTPClient, "https://itevia.com/oauth/token", "https://api.itevia.com", "clientid", "clientsecret")
 		client.accessToken = "myaccesstoken"
 		client.hc = mockedHTTPClient
-		require.Nil(t, client.FetchCSRFToken())
+		require.Nil(t, client.FetchCSRFToken(t.Context()))
 		require.Equal(t, "mycsrftoken", client.csrfToken)
 	})
 }
 
+func TestBTPClientTokenRenewal(t *testing.T) {
+	t.Run("ExpiredAccessToken", func(t *testing.T) {
+		now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+		mockedHTTPClient := newMockedHTTPClient([]mockedResponse{
+			tokenResponse("firsttoken", 600),
+			{res: &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(bytes.NewReader([]byte(`a`)))}},
+			tokenResponse("secondtoken", 600),
+			{res: &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(bytes.NewReader([]byte(`b`)))}},
+		})
+		client := NewBTPClient(mockedHTTPClient, ttokenURL, tapiURL, tclientID, tclientSecret)
+		client.now = func() time.Time { return now }
+		_, err := client.GetIflowResource(t.Context(), Iflow{}, Script{})
+		require.NoError(t, err)
+		require.Equal(t, "firsttoken", client.accessToken)
+		require.Equal(t, now.Add(10*time.Minute), client.tokenExpiry)
+
+		now = now.Add(9*time.Minute + 30*time.Second)
+		_, err = client.GetIflowResource(t.Context(), Iflow{}, Script{})
+		require.NoError(t, err)
+		require.Equal(t, "secondtoken", client.accessToken)
+		require.Empty(t, mockedHTTPClient.responses)
+	})
+
+	t.Run("Unauthorized", func(t *testing.T) {
+		mockedHTTPClient := newMockedHTTPClient([]mockedResponse{
+			{res: &http.Response{StatusCode: http.StatusUnauthorized}},
+			tokenResponse("newtoken", 0),
+			csrfResponse("newcsrftoken"),
+			{res: &http.Response{StatusCode: http.StatusOK}},
+		})
+		client := NewBTPClient(mockedHTTPClient, ttokenURL, tapiURL, tclientID, tclientSecret)
+		client.accessToken = "oldtoken"
+		client.csrfToken = "oldcsrftoken"
+		require.NoError(t, client.UpdateIflowResource(t.Context(), []byte(`data`), Iflow{}, Script{}))
+		require.Equal(t, "newtoken", client.accessToken)
+		require.Equal(t, "newcsrftoken", client.csrfToken)
+		require.Empty(t, mockedHTTPClient.responses)
+	})
+
+	t.Run("UnauthorizedTwice", func(t *testing.T) {
+		mockedHTTPClient := newMockedHTTPClient([]mockedResponse{
+			{res: &http.Response{StatusCode: http.StatusUnauthorized}},
+			tokenResponse("newtoken", 0),
+			{res: &http.Response{StatusCode: http.StatusUnauthorized, Body: io.NopCloser(bytes.NewReader([]byte(`unauthorized`)))}},
+		})
+		client := NewBTPClient(mockedHTTPClient, ttokenURL, tapiURL, tclientID, tclientSecret)
+		client.accessToken = "oldtoken"
+		_, err := client.GetRuntimeArtifact(t.Context(), "iflow1")
+		require.ErrorIs(t, err, ErrUnexpectedStatusCode)
+	})
+
+	t.Run("CSRFTokenRequired", func(t *testing.T) {
+		header := http.Header{}
+		header.Add(xcsrfToken, "Required")
+		mockedHTTPClient := newMockedHTTPClient([]mockedResponse{
+			{res: &http.Response{StatusCode: http.StatusForbidden, Header: header}},
+			csrfResponse("newcsrftoken"),
+			{res: &http.Response{StatusCode: http.StatusAccepted}},
+		})
+		client := NewBTPClient(mockedHTTPClient, ttokenURL, tapiURL, tclientID, tclientSecret)
+		client.accessToken = "mytoken"
+		client.csrfToken = "oldcsrftoken"
+		require.NoError(t, client.DeployIflow(t.Context(), Iflow{}))
+		require.Equal(t, "newcsrftoken", client.csrfToken)
+		require.Empty(t, mockedHTTPClient.responses)
+	})
+
+	t.Run("ForbiddenWithoutCSRFRequired", func(t *testing.T) {
+		mockedHTTPClient := newMockedHTTPClient([]mockedResponse{
+			{res: &http.Response{StatusCode: http.StatusForbidden, Body: io.NopCloser(bytes.NewReader([]byte(`forbidden`)))}},
+		})
+		client := NewBTPClient(mockedHTTPClient, ttokenURL, tapiURL, tclientID, tclientSecret)
+		client.accessToken = "mytoken"
+		client.csrfToken = "mycsrftoken"
+		require.ErrorIs(t, client.DeployIflow(t.Context(), Iflow{}), ErrUnexpectedStatusCode)
+	})
+}
+
+func TestBTPClientRetry(t *testing.T) {
+	newClient := func(responses []mockedResponse) (*BTPClient, *httpClientMock, *[]time.Duration) {
+		mockedHTTPClient := newMockedHTTPClient(responses)
+		client := NewBTPClient(mockedHTTPClient, ttokenURL, tapiURL, tclientID, tclientSecret)
+		client.accessToken = "myaccesstoken"
+		client.csrfToken = "mycsrftoken"
+		client.SetRetryPolicy(RetryPolicy{MaxAttempts: 3, BaseDelay: time.Second, MaxDelay: 4 * time.Second, Deadline: time.Minute})
+		var delays []time.Duration
+		client.sleep = func(delay time.Duration) { delays = append(delays, delay) }
+		return client, mockedHTTPClient, &delays
+	}
+	unavailable := func(retryAfter string) mockedResponse {
+		header := http.Header{}
+		if retryAfter != "" {
+			header.Set("Retry-After", retryAfter)
+		}
+		return mockedResponse{res: &http.Response{StatusCode: http.StatusServiceUnavailable, Header: header, Body: io.NopCloser(bytes.NewReader([]byte(`unavailable`)))}}
+	}
+
+	t.Run("DroppedConnection", func(t *testing.T) {
+		client, mockedHTTPClient, delays := newClient([]mockedResponse{
+			{err: fmt.Errorf("connection reset")},
+			{res: &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(bytes.NewReader([]byte(`data`)))}},
+		})
+		data, err := client.GetIflowResource(t.Context(), Iflow{}, Script{})
+		require.NoError(t, err)
+		require.Equal(t, []byte(`data`), data)
+		require.Len(t, *delays, 1)
+		require.Empty(t, mockedHTTPClient.responses)
+	})
+
+	t.Run("RetryAfter", func(t *testing.T) {
+		client, mockedHTTPClient, delays := newClient([]mockedResponse{
+			unavailable("7"),
+			{res: &http.Response{StatusCode: http.StatusOK}},
+		})
+		require.NoError(t, client.UpdateIflowResource(t.Context(), []byte(`data`), Iflow{}, Script{}))
+		require.Equal(t, []time.Duration{7 * time.Second}, *delays)
+		require.Empty(t, mockedHTTPClient.responses)
+	})
+
+	t.Run("MaxAttempts", func(t *testing.T) {
+		client, mockedHTTPClient, delays := newClient([]mockedResponse{
+			unavailable(""),
+			unavailable(""),
+			unavailable(""),
+		})
+		require.ErrorIs(t, client.DeployIflow(t.Context(), Iflow{}), ErrUnexpectedStatusCode)
+		require.Len(t, *delays, 2)
+		require.Empty(t, mockedHTTPClient.responses)
+	})
+
+	t.Run("Deadline", func(t *testing.T) {
+		client, mockedHTTPClient, delays := newClient([]mockedResponse{
+			unavailable("120"),
+		})
+		require.ErrorIs(t, client.DeployIflow(t.Context(), Iflow{}), ErrUnexpectedStatusCode)
+		require.Empty(t, *delays)
+		require.Empty(t, mockedHTTPClient.responses)
+	})
+
+	t.Run("NonIdempotentGatewayError", func(t *testing.T) {
+		client, mockedHTTPClient, delays := newClient([]mockedResponse{
+			{res: &http.Response{StatusCode: http.StatusBadGateway, Body: io.NopCloser(bytes.NewReader([]byte(`bad gateway`)))}},
+		})
+		require.ErrorIs(t, client.DeployIflow(t.Context(), Iflow{}), ErrUnexpectedStatusCode)
+		require.Empty(t, *delays)
+		require.Empty(t, mockedHTTPClient.responses)
+	})
+
+	t.Run("BodySentAgain", func(t *testing.T) {
+		var bodies []string
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ := io.ReadAll(r.Body)
+			bodies = append(bodies, string(body))
+			if len(bodies) == 1 {
+				w.WriteHeader(http.StatusGatewayTimeout)
+			}
+		}))
+		t.Cleanup(server.Close)
+		client := NewBTPClient(&http.Client{}, server.URL, server.URL, tclientID, tclientSecret)
+		client.accessToken = "myaccesstoken"
+		client.csrfToken = "mycsrftoken"
+		client.sleep = func(time.Duration) {}
+		require.NoError(t, client.UpdateIflowResource(t.Context(), []byte(`data`), Iflow{}, Script{}))
+		require.Len(t, bodies, 2)
+		require.Equal(t, bodies[0], bodies[1])
+		require.NotEmpty(t, bodies[0])
+	})
+}
+
+func TestBTPClientContext(t *testing.T) {
+	t.Run("Canceled", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+		t.Cleanup(server.Close)
+		client := NewBTPClient(&http.Client{}, server.URL, server.URL, tclientID, tclientSecret)
+		ctx, cancel := context.WithCancel(t.Context())
+		cancel()
+		require.ErrorIs(t, client.RequestToken(ctx), context.Canceled)
+	})
+
+	t.Run("CanceledDuringRetry", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(t.Context())
+		mockedHTTPClient := newMockedHTTPClient([]mockedResponse{
+			{res: &http.Response{StatusCode: http.StatusServiceUnavailable}},
+		})
+		client := NewBTPClient(mockedHTTPClient, ttokenURL, tapiURL, tclientID, tclientSecret)
+		client.accessToken = "myaccesstoken"
+		client.sleep = func(time.Duration) { cancel() }
+		_, err := client.GetRuntimeArtifact(ctx, "iflow1")
+		require.ErrorIs(t, err, context.Canceled)
+		require.Empty(t, mockedHTTPClient.responses)
+	})
+}
+
+func tokenResponse(accessToken string, expiresIn int) mockedResponse {
+	body := fmt.Sprintf(`{"access_token":%q,"expires_in":%d}`, accessToken, expiresIn)
+	return mockedResponse{res: &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(bytes.NewReader([]byte(body)))}}
+}
+
+func csrfResponse(csrfToken string) mockedResponse {
+	header := http.Header{}
+	header.Add(xcsrfToken, csrfToken)
+	return mockedResponse{res: &http.Response{StatusCode: http.StatusOK, Header: header}}
+}
+
 type mockedResponse struct {
 	err error
 	res *http.Response
@@ -286,8 +562,242 @@ func (c *httpClientMock) Do(req *http.Request) (*http.Response, error) {
 	return res.res, nil
 }
 
+// closeRecorder is a response body recording whether it was closed.
+type closeRecorder struct {
+	io.Reader
+	closed bool
+}
+
+func (r *closeRecorder) Close() error {
+	r.closed = true
+	return nil
+}
+
 func newMockedHTTPClient(responses []mockedResponse) *httpClientMock {
 	return &httpClientMock{
 		responses: responses,
 	}
 }
+
+func TestBuildDeployIflowRequest(t *testing.T) {
+	_, err := buildDeployIflowRequest(t.Context(), tapiBadURL, Iflow{ID: "iflowid", Version: "active"}, "myaccesstoken", "myxscrftoken")
+	require.Error(t, err)
+	request, err := buildDeployIflowRequest(t.Context(), tapiURL, Iflow{ID: "iflowid", Version: "active"}, "myaccesstoken", "myxscrftoken")
+	require.Nil(t, err)
+	require.Equal(t, http.MethodPost, request.Method)
+	require.Equal(t, "/api/v1/DeployIntegrationDesigntimeArtifact?Id='iflowid'&Version='active'", request.URL.RequestURI())
+	require.Equal(t, "Bearer myaccesstoken", request.Header.Get("Authorization"))
+	require.Equal(t, "myxscrftoken", request.Header.Get(xcsrfToken))
+}
+
+func TestGetRuntimeArtifactFromResponse(t *testing.T) {
+	_, err := getRuntimeArtifactFromResponse(&http.Response{StatusCode: http.StatusNotFound})
+	require.ErrorIs(t, err, ErrArtifactNotFound)
+
+	_, err = getRuntimeArtifactFromResponse(&http.Response{
+		StatusCode: http.StatusBadGateway,
+		Body:       io.NopCloser(bytes.NewReader([]byte(`bad gateway`))),
+	})
+	require.ErrorIs(t, err, ErrUnexpectedStatusCode)
+
+	artifact, err := getRuntimeArtifactFromResponse(&http.Response{
+		StatusCode: http.StatusOK,
+		Body:       io.NopCloser(bytes.NewReader([]byte(`{"d":{"Id":"iflowid","Version":"1.0.2","Status":"STARTED","DeployedBy":"me","DeployedOn":"/Date(1700000000000)/"}}`))),
+	})
+	require.NoError(t, err)
+	require.Equal(t, RuntimeArtifact{ID: "iflowid", Version: "1.0.2", Status: RuntimeStatusStarted, DeployedBy: "me", DeployedOn: "/Date(1700000000000)/"}, artifact)
+}
+
+func TestBTPClientDeployIflow(t *testing.T) {
+	t.Run("NoCSRFToken", func(t *testing.T) {
+		mockedHTTPClient := newMockedHTTPClient([]mockedResponse{{res: &http.Response{StatusCode: http.StatusOK}}})
+		client := NewBTPClient(mockedHTTPClient, ttokenURL, tapiURL, tclientID, tclientSecret)
+		client.accessToken = "myaccesstoken"
+		require.ErrorIs(t, client.DeployIflow(t.Context(), Iflow{}), ErrNoCSRFToken)
+	})
+	t.Run("FailInvalidResponseStatus", func(t *testing.T) {
+		mockedHTTPClient := newMockedHTTPClient([]mockedResponse{{res: &http.Response{StatusCode: http.StatusBadRequest, Body: io.NopCloser(bytes.NewReader([]byte(`{"message":"error cause"}`)))}}})
+		client := NewBTPClient(mockedHTTPClient, ttokenURL, tapiURL, tclientID, tclientSecret)
+		client.accessToken = "myaccesstoken"
+		client.csrfToken = "mycsrftoken"
+		require.ErrorIs(t, client.DeployIflow(t.Context(), Iflow{ID: "iid", Version: "active"}), ErrUnexpectedStatusCode)
+	})
+	t.Run("Valid", func(t *testing.T) {
+		mockedHTTPClient := newMockedHTTPClient([]mockedResponse{{res: &http.Response{StatusCode: http.StatusAccepted}}})
+		client := NewBTPClient(mockedHTTPClient, ttokenURL, tapiURL, tclientID, tclientSecret)
+		client.accessToken = "myaccesstoken"
+		client.csrfToken = "mycsrftoken"
+		require.Nil(t, client.DeployIflow(t.Context(), Iflow{ID: "iid", Version: "active"}))
+	})
+}
+
+func TestBuildGetResourceRequest(t *testing.T) {
+	_, err := buildGetResourceRequest(t.Context(), tapiBadURL, Iflow{ID: "iflowid", Version: "iflowversion"}, Script{ID: "scriptid", Type: "groovy"}, "myaccesstoken")
+	require.Error(t, err)
+	request, err := buildGetResourceRequest(t.Context(), tapiURL, Iflow{ID: "iflowid", Version: "iflowversion"}, Script{ID: "scriptid", Type: "groovy"}, "myaccesstoken")
+	require.Nil(t, err)
+	require.Equal(t, http.MethodGet, request.Method)
+	require.Equal(t, "/api/v1/IntegrationDesigntimeArtifacts(Id='iflowid',Version='iflowversion')/Resources(Name='scriptid',ResourceType='groovy')/$value", request.URL.RequestURI())
+	require.Equal(t, "Bearer myaccesstoken", request.Header.Get("Authorization"))
+}
+
+func TestBTPClientGetIflowResource(t *testing.T) {
+	t.Run("FailRequestToken", func(t *testing.T) {
+		mockedHTTPClient := newMockedHTTPClient([]mockedResponse{{err: fmt.Errorf("http do failed")}})
+		client := NewBTPClient(mockedHTTPClient, ttokenURL, tapiURL, tclientID, tclientSecret)
+		_, err := client.GetIflowResource(t.Context(), Iflow{}, Script{})
+		require.ErrorContains(t, err, "RequestToken: http do failed")
+	})
+	t.Run("NotFound", func(t *testing.T) {
+		mockedHTTPClient := newMockedHTTPClient([]mockedResponse{{res: &http.Response{StatusCode: http.StatusNotFound}}})
+		client := NewBTPClient(mockedHTTPClient, ttokenURL, tapiURL, tclientID, tclientSecret)
+		client.accessToken = "myaccesstoken"
+		_, err := client.GetIflowResource(t.Context(), Iflow{ID: "iid", Version: "active"}, Script{ID: "sid", Type: "groovy"})
+		require.ErrorIs(t, err, ErrResourceNotFound)
+	})
+	t.Run("Valid", func(t *testing.T) {
+		mockedHTTPClient := newMockedHTTPClient([]mockedResponse{{res: &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(bytes.NewReader([]byte(`println "hello"`)))}}})
+		client := NewBTPClient(mockedHTTPClient, ttokenURL, tapiURL, tclientID, tclientSecret)
+		client.accessToken = "myaccesstoken"
+		data, err := client.GetIflowResource(t.Context(), Iflow{ID: "iid", Version: "active"}, Script{ID: "sid", Type: "groovy"})
+		require.NoError(t, err)
+		require.Equal(t, `println "hello"`, string(data))
+	})
+}
+
+func TestGetResourcesFromResponse(t *testing.T) {
+	_, err := getResourcesFromResponse(&http.Response{StatusCode: http.StatusNotFound})
+	require.ErrorIs(t, err, ErrArtifactNotFound)
+
+	_, err = getResourcesFromResponse(&http.Response{
+		StatusCode: http.StatusBadGateway,
+		Body:       io.NopCloser(bytes.NewReader([]byte(`bad gateway`))),
+	})
+	require.ErrorIs(t, err, ErrUnexpectedStatusCode)
+
+	resources, err := getResourcesFromResponse(&http.Response{
+		StatusCode: http.StatusOK,
+		Body:       io.NopCloser(bytes.NewReader([]byte(`{"d":{"results":[{"Name":"script1.groovy","ResourceType":"groovy","ReferencedResourceType":""}]}}`))),
+	})
+	require.NoError(t, err)
+	require.Equal(t, []Resource{{Name: "script1.groovy", ResourceType: "groovy"}}, resources)
+}
+
+func TestBuildDeleteResourceRequest(t *testing.T) {
+	_, err := buildDeleteResourceRequest(t.Context(), tapiBadURL, Iflow{ID: "iflowid", Version: "iflowversion"}, Resource{Name: "scriptid", ResourceType: "groovy"}, "myaccesstoken", "myxscrftoken")
+	require.Error(t, err)
+	request, err := buildDeleteResourceRequest(t.Context(), tapiURL, Iflow{ID: "iflowid", Version: "iflowversion"}, Resource{Name: "scriptid", ResourceType: "groovy"}, "myaccesstoken", "myxscrftoken")
+	require.Nil(t, err)
+	require.Equal(t, http.MethodDelete, request.Method)
+	require.Equal(t, "/api/v1/IntegrationDesigntimeArtifacts(Id='iflowid',Version='iflowversion')/$links/Resources(Name='scriptid',ResourceType='groovy')", request.URL.RequestURI())
+	require.Equal(t, "Bearer myaccesstoken", request.Header.Get("Authorization"))
+	require.Equal(t, "myxscrftoken", request.Header.Get(xcsrfToken))
+}
+
+func TestBuildUpdateArtifactRequest(t *testing.T) {
+	_, err := buildUpdateArtifactRequest(t.Context(), tapiBadURL, Iflow{ID: "iflowid", Version: "active"}, []byte(`{}`), "myaccesstoken", "myxscrftoken")
+	require.Error(t, err)
+	request, err := buildUpdateArtifactRequest(t.Context(), tapiURL, Iflow{ID: "iflowid", Version: "active"}, []byte(`{}`), "myaccesstoken", "myxscrftoken")
+	require.Nil(t, err)
+	require.Equal(t, http.MethodPut, request.Method)
+	require.Equal(t, "/api/v1/IntegrationDesigntimeArtifacts(Id='iflowid',Version='active')", request.URL.RequestURI())
+	require.Equal(t, "Bearer myaccesstoken", request.Header.Get("Authorization"))
+	require.Equal(t, "myxscrftoken", request.Header.Get(xcsrfToken))
+	require.Equal(t, "application/json", request.Header.Get("Content-Type"))
+}
+
+// csrfServer mimics CPI: a csrf token is only valid together with the session cookie it was fetched with.
+type csrfServer struct {
+	mu       sync.Mutex
+	sessions map[string]string
+	tokens   int
+	fetches  int
+	puts     int
+}
+
+func newCSRFServer(t *testing.T) (*httptest.Server, *csrfServer) {
+	cs := &csrfServer{sessions: map[string]string{}}
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /oauth/token", func(w http.ResponseWriter, r *http.Request) {
+		cs.mu.Lock()
+		defer cs.mu.Unlock()
+		cs.tokens++
+		w.Write([]byte(`{"access_token":"myaccesstoken","expires_in":3600}`))
+	})
+	mux.HandleFunc("GET /api/v1/", func(w http.ResponseWriter, r *http.Request) {
+		cs.mu.Lock()
+		defer cs.mu.Unlock()
+		if r.Header.Get(xcsrfToken) != xcsrfFetch {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		session := fmt.Sprintf("session%d", cs.fetches)
+		token := fmt.Sprintf("token%d", cs.fetches)
+		cs.sessions[session] = token
+		cs.fetches++
+		http.SetCookie(w, &http.Cookie{Name: "JSESSIONID", Value: session, Path: "/"})
+		w.Header().Set(xcsrfToken, token)
+	})
+	mux.HandleFunc("PUT /api/v1/", func(w http.ResponseWriter, r *http.Request) {
+		cs.mu.Lock()
+		defer cs.mu.Unlock()
+		cookie, err := r.Cookie("JSESSIONID")
+		if err != nil || cs.sessions[cookie.Value] == "" || cs.sessions[cookie.Value] != r.Header.Get(xcsrfToken) {
+			w.Header().Set(xcsrfToken, "Required")
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		cs.puts++
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server, cs
+}
+
+func TestBTPClientSessionCookies(t *testing.T) {
+	t.Run("CookieSentWithCSRFToken", func(t *testing.T) {
+		server, cs := newCSRFServer(t)
+		client := NewBTPClient(&http.Client{}, server.URL+"/oauth/token", server.URL, tclientID, tclientSecret)
+		require.NoError(t, client.UpdateIflowResource(t.Context(), []byte(`data`), Iflow{ID: "iid", Version: "active"}, Script{ID: "sid", Type: "groovy"}))
+		require.NoError(t, client.UpdateIflowResource(t.Context(), []byte(`data`), Iflow{ID: "iid", Version: "active"}, Script{ID: "sid", Type: "groovy"}))
+		require.Equal(t, 2, cs.puts)
+		require.Len(t, cs.sessions, 1)
+	})
+
+	t.Run("ExpiredSession", func(t *testing.T) {
+		server, cs := newCSRFServer(t)
+		client := NewBTPClient(&http.Client{}, server.URL+"/oauth/token", server.URL, tclientID, tclientSecret)
+		require.NoError(t, client.UpdateIflowResource(t.Context(), []byte(`data`), Iflow{ID: "iid", Version: "active"}, Script{ID: "sid", Type: "groovy"}))
+		delete(cs.sessions, "session0")
+		require.NoError(t, client.UpdateIflowResource(t.Context(), []byte(`data`), Iflow{ID: "iid", Version: "active"}, Script{ID: "sid", Type: "groovy"}))
+		require.Equal(t, 2, cs.puts)
+		require.Equal(t, "token1", client.csrfToken)
+	})
+
+	t.Run("Concurrent", func(t *testing.T) {
+		server, cs := newCSRFServer(t)
+		client := NewBTPClient(&http.Client{}, server.URL+"/oauth/token", server.URL, tclientID, tclientSecret)
+		var wg sync.WaitGroup
+		errs := make([]error, 20)
+		for i := range errs {
+			wg.Go(func() {
+				errs[i] = client.UpdateIflowResource(t.Context(), []byte(`data`), Iflow{ID: "iid", Version: "active"}, Script{ID: "sid", Type: "groovy"})
+			})
+		}
+		wg.Wait()
+		for _, err := range errs {
+			require.NoError(t, err)
+		}
+		require.Equal(t, 20, cs.puts)
+		require.Equal(t, 1, cs.tokens)
+		require.Equal(t, 1, cs.fetches)
+	})
+
+	t.Run("WithoutJar", func(t *testing.T) {
+		server, cs := newCSRFServer(t)
+		client := NewBTPClient(&http.Client{}, server.URL+"/oauth/token", server.URL, tclientID, tclientSecret)
+		client.jar = nil
+		require.ErrorIs(t, client.UpdateIflowResource(t.Context(), []byte(`data`), Iflow{ID: "iid", Version: "active"}, Script{ID: "sid", Type: "groovy"}), ErrUnexpectedStatusCode)
+		require.Zero(t, cs.puts)
+	})
+}
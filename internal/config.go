@@ -1,30 +1,114 @@
 package internal
 
 import (
-	"github.com/goccy/go-yaml"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var ErrUnknownResourceType = errors.New("unknown resource type")
+
+// resourceTypes maps accepted script types to their CPI ResourceType value.
+var resourceTypes = map[string]string{
+	"groovy":           ResourceTypeGroovy,
+	"gsh":              ResourceTypeGroovy,
+	"js":               ResourceTypeJS,
+	"javascript":       ResourceTypeJS,
+	"xslt":             ResourceTypeXSLT,
+	"xsl":              ResourceTypeXSLT,
+	"mmap":             ResourceTypeMessageMapping,
+	"messagemapping":   ResourceTypeMessageMapping,
+	"opmap":            ResourceTypeOperationMapping,
+	"operationmapping": ResourceTypeOperationMapping,
+	"xsd":              ResourceTypeXSD,
+	"wsdl":             ResourceTypeWSDL,
+	"edmx":             ResourceTypeEDMX,
+	"jar":              ResourceTypeJAR,
+	"archive":          ResourceTypeJAR,
+}
+
+const (
+	// CPI ResourceType values.
+	ResourceTypeGroovy           = "groovy"
+	ResourceTypeJS               = "js"
+	ResourceTypeXSLT             = "xslt"
+	ResourceTypeMessageMapping   = "mmap"
+	ResourceTypeOperationMapping = "opmap"
+	ResourceTypeXSD              = "xsd"
+	ResourceTypeWSDL             = "wsdl"
+	ResourceTypeEDMX             = "edmx"
+	ResourceTypeJAR              = "jar"
 )
 
 type Config struct {
-	IntegrationSuiteTokenURL string   `yaml:"tokenURL"`
-	IntegrationSuiteAPIURL   string   `yaml:"url"`
+	IntegrationSuiteTokenURL string   `yaml:"tokenURL,omitempty"`
+	IntegrationSuiteAPIURL   string   `yaml:"url,omitempty"`
 	TestPaths                []string `yaml:"testPaths"`
 	UploadScripts            []Iflow  `yaml:"uploadScripts"`
+	// Test tunes the execution of the test scripts.
+	Test TestOptions `yaml:"test,omitempty"`
+	// Concurrency is the maximum number of scripts uploaded at the same time.
+	Concurrency int `yaml:"concurrency,omitempty"`
+	// Retry tunes the retries of the transient CPI failures.
+	Retry RetryPolicy `yaml:"retry,omitempty"`
 }
 
 type Iflow struct {
 	ID      string   `yaml:"id"`
 	Version string   `yaml:"version"`
 	Scripts []Script `yaml:"scripts"`
+	Deploy  bool     `yaml:"deploy,omitempty"`
+	// Path is an optional unpacked iflow directory uploaded as the whole design-time artifact.
+	Path string `yaml:"path,omitempty"`
 }
 
 type Script struct {
 	ID   string `yaml:"id"`
 	Type string `yaml:"type"`
 	Path string `yaml:"path"`
+	// Tests are message cases run against the script by inco test.
+	Tests []MessageCase `yaml:"tests,omitempty"`
 }
 
-func LoadConfig(data []byte) Config {
+// ConfigChecks selects the files of the manifest LoadConfig checks on disk,
+// so that commands not reading them load a manifest whose files are missing.
+type ConfigChecks struct {
+	// Scripts checks the script paths and the unpacked iflow directories exist.
+	Scripts bool
+	// Tests checks the test paths match test scripts, and the files of the script tests and of the test section exist.
+	Tests bool
+}
+
+// LoadConfig decodes the manifest and validates it, checking the files selected by checks exist.
+// Every problem found is reported in the returned ConfigErrors.
+func LoadConfig(data []byte, checks ConfigChecks) (Config, error) {
 	var cfg Config
-	yaml.Unmarshal(data, &cfg)
-	return cfg
+	if errs := decodeConfig(data, &cfg, checks); len(errs) > 0 {
+		return cfg, errs
+	}
+	return cfg, nil
+}
+
+// resourceTypeExtensions maps iflow resource file extensions to their CPI ResourceType value.
+var resourceTypeExtensions = map[string]string{
+	".groovy": ResourceTypeGroovy,
+	".gsh":    ResourceTypeGroovy,
+	".js":     ResourceTypeJS,
+	".xsl":    ResourceTypeXSLT,
+	".xslt":   ResourceTypeXSLT,
+	".mmap":   ResourceTypeMessageMapping,
+	".opmap":  ResourceTypeOperationMapping,
+	".xsd":    ResourceTypeXSD,
+	".wsdl":   ResourceTypeWSDL,
+	".edmx":   ResourceTypeEDMX,
+	".jar":    ResourceTypeJAR,
+}
+
+// ResolveResourceType returns the CPI ResourceType value of a script type.
+func ResolveResourceType(scriptType string) (string, error) {
+	resourceType, ok := resourceTypes[strings.ToLower(scriptType)]
+	if !ok {
+		return "", fmt.Errorf("%w: %q", ErrUnknownResourceType, scriptType)
+	}
+	return resourceType, nil
 }
@@ -0,0 +1,348 @@
+package internal
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestResolveResourceType(t *testing.T) {
+	for scriptType, expected := range map[string]string{
+		"groovy":         ResourceTypeGroovy,
+		"JavaScript":     ResourceTypeJS,
+		"xsl":            ResourceTypeXSLT,
+		"messageMapping": ResourceTypeMessageMapping,
+		"opmap":          ResourceTypeOperationMapping,
+		"xsd":            ResourceTypeXSD,
+		"wsdl":           ResourceTypeWSDL,
+		"edmx":           ResourceTypeEDMX,
+		"archive":        ResourceTypeJAR,
+	} {
+		resourceType, err := ResolveResourceType(scriptType)
+		require.NoError(t, err)
+		require.Equal(t, expected, resourceType)
+	}
+	_, err := ResolveResourceType("python")
+	require.ErrorIs(t, err, ErrUnknownResourceType)
+}
+
+// allChecks checks every file of the manifest.
+var allChecks = ConfigChecks{Scripts: true, Tests: true}
+
+// withRequired completes a partial manifest with the required fields it lacks, after its own lines.
+func withRequired(manifest string) []byte {
+	if !strings.Contains(manifest, "testPaths:") {
+		manifest += "testPaths: []\n"
+	}
+	if !strings.Contains(manifest, "uploadScripts:") {
+		manifest += "uploadScripts:\n  - id: iflow1\n    version: active\n    scripts:\n      - {id: script1, type: groovy, path: src/script1.groovy}\n"
+	}
+	return []byte(manifest)
+}
+
+func TestLoadConfig(t *testing.T) {
+	dir := t.TempDir()
+	t.Chdir(dir)
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "src"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "src", "script1.groovy"), []byte(`def x`), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "runTests.groovy"), []byte(`def x`), 0o644))
+
+	t.Run("Valid", func(t *testing.T) {
+		config, err := LoadConfig([]byte(`tokenURL: https://tenant.authentication.eu10.hana.ondemand.com
+url: https://tenant.hana.ondemand.com
+testPaths:
+  - runTests.groovy
+uploadScripts:
+  - id: iflow1
+    version: 1.0.2
+    deploy: true
+    scripts:
+      - id: script1.groovy
+        type: Groovy
+        path: src/script1.groovy
+`), allChecks)
+		require.NoError(t, err)
+		require.Equal(t, Config{
+			IntegrationSuiteTokenURL: "https://tenant.authentication.eu10.hana.ondemand.com",
+			IntegrationSuiteAPIURL:   "https://tenant.hana.ondemand.com",
+			TestPaths:                []string{"runTests.groovy"},
+			UploadScripts: []Iflow{{ID: "iflow1", Version: "1.0.2", Deploy: true, Scripts: []Script{
+				{ID: "script1.groovy", Type: ResourceTypeGroovy, Path: "src/script1.groovy"},
+			}}},
+		}, config)
+	})
+
+	t.Run("SyntaxError", func(t *testing.T) {
+		_, err := LoadConfig([]byte("testPaths:\n  - a\n - b\n"), allChecks)
+		var configErrors ConfigErrors
+		require.ErrorAs(t, err, &configErrors)
+		require.Len(t, configErrors, 1)
+	})
+
+	t.Run("UnknownFields", func(t *testing.T) {
+		_, err := LoadConfig([]byte(`uploadScript:
+  - id: iflow1
+testPaths:
+  - runTests.groovy
+uploadScripts:
+  - id: iflow1
+    version: active
+    script: []
+`), allChecks)
+		var configErrors ConfigErrors
+		require.ErrorAs(t, err, &configErrors)
+		require.Equal(t, ConfigErrors{
+			{Line: 1, Column: 1, Field: "uploadScript", Message: "unknown field"},
+			{Line: 8, Column: 5, Field: "uploadScripts[0].script", Message: "unknown field"},
+			{Line: 6, Column: 5, Field: "uploadScripts[0].scripts", Message: "required unless path is set"},
+		}, configErrors)
+	})
+
+	t.Run("InvalidFields", func(t *testing.T) {
+		_, err := LoadConfig([]byte(`url: tenant.hana.ondemand.com
+testPaths:
+  - missing.groovy
+uploadScripts:
+  - version: latest
+    scripts:
+      - id: script1.groovy
+        type: python
+        path: src/script1.groovy
+      - id: script2.groovy
+        type: groovy
+`), allChecks)
+		var configErrors ConfigErrors
+		require.ErrorAs(t, err, &configErrors)
+		require.Equal(t, ConfigErrors{
+			{Line: 1, Column: 6, Field: "url", Message: `"tenant.hana.ondemand.com" is not a valid http(s) URL`},
+			{Line: 3, Column: 5, Field: "testPaths[0]", Message: `"missing.groovy" does not exist`},
+			{Line: 5, Column: 5, Field: "uploadScripts[0].id", Message: "required"},
+			{Line: 5, Column: 14, Field: "uploadScripts[0].version", Message: "\"latest\" must be `active` or a x.x.x version"},
+			{Line: 8, Column: 15, Field: "uploadScripts[0].scripts[0].type", Message: `unknown resource type: "python"`},
+			{Line: 10, Column: 9, Field: "uploadScripts[0].scripts[1].path", Message: "required"},
+		}, configErrors)
+		require.Equal(t, "inco.yaml:1:6: url: \"tenant.hana.ondemand.com\" is not a valid http(s) URL", configErrors.WithFile("inco.yaml")[0].Error())
+	})
+
+	t.Run("InvalidIflowPath", func(t *testing.T) {
+		_, err := LoadConfig(withRequired(`uploadScripts:
+  - id: iflow1
+    version: active
+    path: src
+`), allChecks)
+		var configErrors ConfigErrors
+		require.ErrorAs(t, err, &configErrors)
+		require.Equal(t, ConfigErrors{
+			{Line: 4, Column: 11, Field: "uploadScripts[0].path", Message: `"src" is not an unpacked iflow directory: META-INF/MANIFEST.MF not found`},
+		}, configErrors)
+	})
+
+	t.Run("NegativeConcurrency", func(t *testing.T) {
+		_, err := LoadConfig(withRequired("concurrency: -1\n"), allChecks)
+		var configErrors ConfigErrors
+		require.ErrorAs(t, err, &configErrors)
+		require.Equal(t, ConfigErrors{
+			{Line: 1, Column: 14, Field: "concurrency", Message: "-1 must not be negative"},
+		}, configErrors)
+	})
+
+	t.Run("Retry", func(t *testing.T) {
+		config, err := LoadConfig(withRequired("retry:\n  maxAttempts: 5\n  deadline: 2m\n"), allChecks)
+		require.NoError(t, err)
+		require.Equal(t, RetryPolicy{MaxAttempts: 5, Deadline: 2 * time.Minute}, config.Retry)
+
+		_, err = LoadConfig(withRequired("retry:\n  maxAttempts: -1\n  baseDelay: -1s\n"), allChecks)
+		var configErrors ConfigErrors
+		require.ErrorAs(t, err, &configErrors)
+		require.Equal(t, ConfigErrors{
+			{Line: 2, Column: 16, Field: "retry.maxAttempts", Message: "-1 must not be negative"},
+			{Line: 3, Column: 14, Field: "retry.baseDelay", Message: "-1s must not be negative"},
+		}, configErrors)
+	})
+
+	t.Run("TestPathPatterns", func(t *testing.T) {
+		config, err := LoadConfig(withRequired("testPaths:\n  - src/*.groovy\n  - '!src/script2.groovy'\n"), allChecks)
+		require.NoError(t, err)
+		require.Equal(t, []string{"src/*.groovy", "!src/script2.groovy"}, config.TestPaths)
+
+		_, err = LoadConfig(withRequired("testPaths:\n  - tests/**/*Test.groovy\n  - '![bad'\n"), allChecks)
+		var configErrors ConfigErrors
+		require.ErrorAs(t, err, &configErrors)
+		require.Equal(t, ConfigErrors{
+			{Line: 2, Column: 5, Field: "testPaths[0]", Message: `"tests/**/*Test.groovy" matches no test script`},
+			{Line: 3, Column: 5, Field: "testPaths[1]", Message: `"[bad" is not a valid pattern`},
+		}, configErrors)
+	})
+
+	t.Run("TestSection", func(t *testing.T) {
+		config, err := LoadConfig(withRequired(`test:
+  timeout: 90s
+  groovyBinary: /opt/groovy/bin/groovy
+  classpath:
+    - src
+    - src/*.groovy
+  jvmOpts:
+    - -Xmx512m
+  env:
+    CPI_ENV: dev
+  workingDir: src
+`), allChecks)
+		require.NoError(t, err)
+		require.Equal(t, TestOptions{
+			Timeout:      90 * time.Second,
+			GroovyBinary: "/opt/groovy/bin/groovy",
+			Classpath:    []string{"src", "src/*.groovy"},
+			JVMOpts:      []string{"-Xmx512m"},
+			Env:          map[string]string{"CPI_ENV": "dev"},
+			WorkingDir:   "src",
+		}, config.Test)
+
+		_, err = LoadConfig(withRequired(`test:
+  classpath:
+    - lib
+    - lib/*.jar
+  workingDir: runTests.groovy
+  coverage:
+    jacocoHome: jacoco
+    minLineCoverage: 120
+`), allChecks)
+		var configErrors ConfigErrors
+		require.ErrorAs(t, err, &configErrors)
+		require.Equal(t, ConfigErrors{
+			{Line: 3, Column: 7, Field: "test.classpath[0]", Message: `"lib" does not exist`},
+			{Line: 4, Column: 7, Field: "test.classpath[1]", Message: `classpath "lib/*.jar" matches no file`},
+			{Line: 5, Column: 15, Field: "test.workingDir", Message: `"runTests.groovy" is not a directory`},
+			{Line: 7, Column: 17, Field: "test.coverage.jacocoHome", Message: `"jacoco" does not exist`},
+			{Line: 8, Column: 22, Field: "test.coverage.minLineCoverage", Message: "120 must be between 0 and 100"},
+		}, configErrors)
+	})
+
+	t.Run("ScriptTests", func(t *testing.T) {
+		config, err := LoadConfig(withRequired(`uploadScripts:
+  - id: iflow1
+    version: active
+    scripts:
+      - id: script1
+        type: groovy
+        path: src/script1.groovy
+        tests:
+          - name: maps order
+            function: transform
+            bodyFile: src/script1.groovy
+            headers:
+              SAPMessageId: "1"
+            expected:
+              properties:
+                tmp: null
+              assertions:
+                - xpath: /order/id
+                  equals: 42
+                - header: OrderId
+                  matches: ^A\d+$
+`), allChecks)
+		require.NoError(t, err)
+		equals := "42"
+		require.Equal(t, []MessageCase{{
+			Name:     "maps order",
+			Function: "transform",
+			BodyFile: "src/script1.groovy",
+			Headers:  map[string]any{"SAPMessageId": "1"},
+			Expected: ExpectedMessage{
+				Properties: map[string]any{"tmp": nil},
+				Assertions: []Assertion{{XPath: "/order/id", Equals: &equals}, {Header: "OrderId", Matches: `^A\d+$`}},
+			},
+		}}, config.UploadScripts[0].Scripts[0].Tests)
+
+		_, err = LoadConfig(withRequired(`uploadScripts:
+  - id: iflow1
+    version: active
+    scripts:
+      - id: script1
+        type: groovy
+        path: src/script1.groovy
+        tests:
+          - bodyFile: missing.xml
+            expected:
+              assertions:
+                - xpath: /order/id
+                  jsonPath: $.id
+                  equals: "1"
+                - header: OrderId
+`), allChecks)
+		var configErrors ConfigErrors
+		require.ErrorAs(t, err, &configErrors)
+		require.Equal(t, ConfigErrors{
+			{Line: 9, Column: 13, Field: "uploadScripts[0].scripts[0].tests[0].name", Message: "required"},
+			{Line: 9, Column: 23, Field: "uploadScripts[0].scripts[0].tests[0].bodyFile", Message: `"missing.xml" does not exist`},
+			{Line: 12, Column: 19, Field: "uploadScripts[0].scripts[0].tests[0].expected.assertions[0]", Message: "only one of header, property, xpath or jsonPath can be set"},
+			{Line: 15, Column: 19, Field: "uploadScripts[0].scripts[0].tests[0].expected.assertions[1]", Message: "one of equals or matches is required"},
+		}, configErrors)
+	})
+
+	t.Run("Required", func(t *testing.T) {
+		_, err := LoadConfig([]byte("concurrency: 2\n"), allChecks)
+		var configErrors ConfigErrors
+		require.ErrorAs(t, err, &configErrors)
+		require.Equal(t, ConfigErrors{
+			{Line: 1, Column: 1, Field: "testPaths", Message: "required"},
+			{Line: 1, Column: 1, Field: "uploadScripts", Message: "required"},
+		}, configErrors)
+
+		_, err = LoadConfig(nil, allChecks)
+		require.ErrorAs(t, err, &configErrors)
+		require.Len(t, configErrors, 2)
+	})
+
+	t.Run("RawVersion", func(t *testing.T) {
+		_, err := LoadConfig([]byte("testPaths: []\nuploadScripts:\n  - id: iflow1\n    version: 1.0\n    path: src\n"), ConfigChecks{})
+		var configErrors ConfigErrors
+		require.ErrorAs(t, err, &configErrors)
+		require.Equal(t, ConfigErrors{
+			{Line: 4, Column: 14, Field: "uploadScripts[0].version", Message: "\"1.0\" must be `active` or a x.x.x version"},
+		}, configErrors)
+	})
+
+	t.Run("NoFileChecks", func(t *testing.T) {
+		manifest := []byte(`testPaths:
+  - tests/**/*Test.groovy
+uploadScripts:
+  - id: iflow1
+    version: active
+    scripts:
+      - id: new.groovy
+        type: groovy
+        path: src/new.groovy
+        tests:
+          - name: a
+            bodyFile: missing.xml
+`)
+		config, err := LoadConfig(manifest, ConfigChecks{})
+		require.NoError(t, err)
+		require.Equal(t, "src/new.groovy", config.UploadScripts[0].Scripts[0].Path)
+
+		_, err = LoadConfig(manifest, ConfigChecks{Scripts: true})
+		var configErrors ConfigErrors
+		require.ErrorAs(t, err, &configErrors)
+		require.Equal(t, ConfigErrors{
+			{Line: 9, Column: 15, Field: "uploadScripts[0].scripts[0].path", Message: `"src/new.groovy" does not exist`},
+		}, configErrors)
+
+		_, err = LoadConfig(manifest, ConfigChecks{Tests: true})
+		require.ErrorAs(t, err, &configErrors)
+		require.Equal(t, ConfigErrors{
+			{Line: 2, Column: 5, Field: "testPaths[0]", Message: `"tests/**/*Test.groovy" matches no test script`},
+			{Line: 12, Column: 23, Field: "uploadScripts[0].scripts[0].tests[0].bodyFile", Message: `"missing.xml" does not exist`},
+		}, configErrors)
+	})
+
+	t.Run("TypeMismatch", func(t *testing.T) {
+		_, err := LoadConfig([]byte("testPaths: runTests.groovy\n"), allChecks)
+		var configErrors ConfigErrors
+		require.ErrorAs(t, err, &configErrors)
+		require.Equal(t, 1, configErrors[0].Line)
+	})
+}
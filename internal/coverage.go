@@ -0,0 +1,401 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrJaCoCoNotFound       = errors.New("jacoco not found")
+	ErrJavaNotFound         = errors.New("java not found")
+	ErrCoverageBelowMinimum = errors.New("line coverage below the minimum")
+)
+
+const (
+	defaultCoverageDir = "coverage"
+	// jacocoAgentJar and jacocoCLIJar are relative to the JaCoCo distribution directory.
+	jacocoAgentJar = "lib/jacocoagent.jar"
+	jacocoCLIJar   = "lib/jacococli.jar"
+
+	coverageExecFile         = "jacoco.exec"
+	coverageClassesDir       = "classes"
+	coverageHTMLDir          = "html"
+	coverageJaCoCoXMLFile    = "jacoco.xml"
+	coverageCoberturaXMLFile = "cobertura.xml"
+	coberturaDoctype         = `<!DOCTYPE coverage SYSTEM "http://cobertura.sourceforge.net/xml/coverage-04.dtd">`
+)
+
+// CoverageOptions configures the line coverage of the groovy scripts measured by inco test --coverage.
+type CoverageOptions struct {
+	// JaCoCoHome is the JaCoCo distribution directory, JACOCO_HOME when empty.
+	JaCoCoHome string `yaml:"jacocoHome,omitempty"`
+	// Dir receives the coverage data and reports, `coverage` when empty.
+	Dir string `yaml:"dir,omitempty"`
+	// MinLineCoverage is the minimum percentage of covered lines of every groovy script.
+	MinLineCoverage float64 `yaml:"minLineCoverage,omitempty"`
+}
+
+func (o CoverageOptions) dir() string {
+	if o.Dir == "" {
+		return defaultCoverageDir
+	}
+	return o.Dir
+}
+
+// ScriptCoverage is the line coverage of a groovy script.
+type ScriptCoverage struct {
+	Path    string
+	Covered int
+	Missed  int
+}
+
+// Percent is the percentage of covered lines, 0 for a script never loaded.
+func (c ScriptCoverage) Percent() float64 {
+	if c.Covered+c.Missed == 0 {
+		return 0
+	}
+	return 100 * float64(c.Covered) / float64(c.Covered+c.Missed)
+}
+
+// CoverageAgent clears the coverage data of a previous run, and returns the JVM option
+// running the JaCoCo agent on the groovy scripts.
+// The agent dumps the classes it measures, so that the reports match the classes compiled by the tests.
+func CoverageAgent(opts CoverageOptions, scripts []Script) (string, error) {
+	home, err := jacocoHome(opts)
+	if err != nil {
+		return "", err
+	}
+	dir, err := filepath.Abs(opts.dir())
+	if err != nil {
+		return "", err
+	}
+	for _, name := range []string{coverageExecFile, coverageClassesDir} {
+		if err := os.RemoveAll(filepath.Join(dir, name)); err != nil {
+			return "", err
+		}
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", err
+	}
+	var includes []string
+	for _, script := range groovyScripts(scripts) {
+		// groovy names the script class after its file, closures are nested classes.
+		name := strings.TrimSuffix(filepath.Base(script.Path), filepath.Ext(script.Path))
+		includes = append(includes, name, name+"$*", "*."+name, "*."+name+"$*")
+	}
+	if len(includes) == 0 {
+		return "", errors.New("coverage: uploadScripts have no groovy script")
+	}
+	// classes compiled by groovy at runtime may have no code source location.
+	return fmt.Sprintf("-javaagent:%s=destfile=%s,append=true,inclnolocationclasses=true,classdumpdir=%s,includes=%s",
+		filepath.Join(home, filepath.FromSlash(jacocoAgentJar)),
+		filepath.Join(dir, coverageExecFile),
+		filepath.Join(dir, coverageClassesDir),
+		strings.Join(includes, ":"),
+	), nil
+}
+
+// jacocoHome returns the JaCoCo distribution directory holding the agent and the command line jars.
+func jacocoHome(opts CoverageOptions) (string, error) {
+	home := opts.JaCoCoHome
+	if home == "" {
+		home = os.Getenv("JACOCO_HOME")
+	}
+	if home == "" {
+		return "", fmt.Errorf("%w: set test.coverage.jacocoHome or JACOCO_HOME", ErrJaCoCoNotFound)
+	}
+	for _, jar := range []string{jacocoAgentJar, jacocoCLIJar} {
+		if _, err := os.Stat(filepath.Join(home, filepath.FromSlash(jar))); err != nil {
+			return "", fmt.Errorf("%w: %s not found in %q", ErrJaCoCoNotFound, jar, home)
+		}
+	}
+	return filepath.Abs(home)
+}
+
+// WriteCoverageReports writes the HTML, JaCoCo XML and Cobertura XML reports of the coverage data
+// recorded by the agent, and returns the line coverage of every groovy script.
+func WriteCoverageReports(ctx context.Context, opts CoverageOptions, scripts []Script, stdout, stderr io.Writer) ([]ScriptCoverage, error) {
+	home, err := jacocoHome(opts)
+	if err != nil {
+		return nil, err
+	}
+	java, err := lookupJava()
+	if err != nil {
+		return nil, err
+	}
+	measured := groovyScripts(scripts)
+	dir := opts.dir()
+	execFile := filepath.Join(dir, coverageExecFile)
+	if _, err := os.Stat(execFile); err != nil {
+		return nil, fmt.Errorf("coverage: no data recorded in %s", execFile)
+	}
+
+	var sources []string
+	for _, script := range measured {
+		if source := filepath.Dir(script.Path); !slices.Contains(sources, source) {
+			sources = append(sources, source)
+		}
+	}
+	args := []string{"-jar", filepath.Join(home, filepath.FromSlash(jacocoCLIJar)), "report", execFile,
+		"--classfiles", filepath.Join(dir, coverageClassesDir),
+		"--html", filepath.Join(dir, coverageHTMLDir),
+		"--xml", filepath.Join(dir, coverageJaCoCoXMLFile),
+		"--name", "inco",
+	}
+	for _, source := range sources {
+		args = append(args, "--sourcefiles", source)
+	}
+	cmd := exec.CommandContext(ctx, java, args...)
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("jacoco report: %w", err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, coverageJaCoCoXMLFile))
+	if err != nil {
+		return nil, err
+	}
+	var report jacocoReport
+	if err := xml.Unmarshal(data, &report); err != nil {
+		return nil, fmt.Errorf("reading %s: %w", coverageJaCoCoXMLFile, err)
+	}
+	var cobertura bytes.Buffer
+	if err := writeCobertura(report, sources, &cobertura); err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(filepath.Join(dir, coverageCoberturaXMLFile), cobertura.Bytes(), 0o644); err != nil {
+		return nil, err
+	}
+	return scriptCoverages(report, measured), nil
+}
+
+// lookupJava returns the java of JAVA_HOME, else the one in PATH.
+func lookupJava() (string, error) {
+	if home := os.Getenv("JAVA_HOME"); home != "" {
+		if java, err := exec.LookPath(filepath.Join(home, "bin", "java")); err == nil {
+			return java, nil
+		}
+	}
+	java, err := exec.LookPath("java")
+	if err != nil {
+		return "", fmt.Errorf("%w: set JAVA_HOME or add java to PATH", ErrJavaNotFound)
+	}
+	return java, nil
+}
+
+// CheckCoverage reports the scripts whose line coverage is below minimum.
+func CheckCoverage(coverages []ScriptCoverage, minimum float64) error {
+	var below []string
+	for _, coverage := range coverages {
+		if coverage.Percent() < minimum {
+			below = append(below, fmt.Sprintf("%s %.1f%%", coverage.Path, coverage.Percent()))
+		}
+	}
+	if len(below) > 0 {
+		return fmt.Errorf("%w %.1f%%: %s", ErrCoverageBelowMinimum, minimum, strings.Join(below, ", "))
+	}
+	return nil
+}
+
+// jacocoReport is the part of the JaCoCo XML report converted to Cobertura.
+type jacocoReport struct {
+	Sessions []struct {
+		Dump int64 `xml:"dump,attr"`
+	} `xml:"sessioninfo"`
+	Packages []jacocoPackage `xml:"package"`
+}
+
+type jacocoPackage struct {
+	Name        string             `xml:"name,attr"`
+	SourceFiles []jacocoSourceFile `xml:"sourcefile"`
+}
+
+type jacocoSourceFile struct {
+	Name  string       `xml:"name,attr"`
+	Lines []jacocoLine `xml:"line"`
+}
+
+// jacocoLine counts the missed and covered instructions and branches of a line.
+type jacocoLine struct {
+	Number int `xml:"nr,attr"`
+	MI     int `xml:"mi,attr"`
+	CI     int `xml:"ci,attr"`
+	MB     int `xml:"mb,attr"`
+	CB     int `xml:"cb,attr"`
+}
+
+// sourcePath is the path of the source file relative to its source directory.
+func (p jacocoPackage) sourcePath(file jacocoSourceFile) string {
+	return path.Join(p.Name, file.Name)
+}
+
+// scriptCoverages matches the source files of the report with the scripts by path.
+func scriptCoverages(report jacocoReport, scripts []Script) []ScriptCoverage {
+	coverages := make([]ScriptCoverage, 0, len(scripts))
+	for _, script := range scripts {
+		coverage := ScriptCoverage{Path: script.Path}
+		scriptPath := path.Clean(filepath.ToSlash(script.Path))
+	match:
+		for _, pkg := range report.Packages {
+			for _, file := range pkg.SourceFiles {
+				sourcePath := pkg.sourcePath(file)
+				if scriptPath == sourcePath || strings.HasSuffix(scriptPath, "/"+sourcePath) {
+					for _, line := range file.Lines {
+						if line.CI > 0 {
+							coverage.Covered++
+						} else {
+							coverage.Missed++
+						}
+					}
+					break match
+				}
+			}
+		}
+		coverages = append(coverages, coverage)
+	}
+	return coverages
+}
+
+// coberturaCoverage is the root of a Cobertura XML report.
+type coberturaCoverage struct {
+	XMLName         xml.Name           `xml:"coverage"`
+	LineRate        string             `xml:"line-rate,attr"`
+	BranchRate      string             `xml:"branch-rate,attr"`
+	LinesCovered    int                `xml:"lines-covered,attr"`
+	LinesValid      int                `xml:"lines-valid,attr"`
+	BranchesCovered int                `xml:"branches-covered,attr"`
+	BranchesValid   int                `xml:"branches-valid,attr"`
+	Complexity      string             `xml:"complexity,attr"`
+	Version         string             `xml:"version,attr"`
+	Timestamp       int64              `xml:"timestamp,attr"`
+	Sources         []string           `xml:"sources>source"`
+	Packages        []coberturaPackage `xml:"packages>package"`
+}
+
+type coberturaPackage struct {
+	Name       string           `xml:"name,attr"`
+	LineRate   string           `xml:"line-rate,attr"`
+	BranchRate string           `xml:"branch-rate,attr"`
+	Complexity string           `xml:"complexity,attr"`
+	Classes    []coberturaClass `xml:"classes>class"`
+}
+
+type coberturaClass struct {
+	Name       string          `xml:"name,attr"`
+	Filename   string          `xml:"filename,attr"`
+	LineRate   string          `xml:"line-rate,attr"`
+	BranchRate string          `xml:"branch-rate,attr"`
+	Complexity string          `xml:"complexity,attr"`
+	Methods    struct{}        `xml:"methods"`
+	Lines      []coberturaLine `xml:"lines>line"`
+}
+
+type coberturaLine struct {
+	Number            int    `xml:"number,attr"`
+	Hits              int    `xml:"hits,attr"`
+	Branch            bool   `xml:"branch,attr"`
+	ConditionCoverage string `xml:"condition-coverage,attr,omitempty"`
+}
+
+// coverageCounts sums the covered and valid lines and branches.
+type coverageCounts struct {
+	linesCovered, linesValid, branchesCovered, branchesValid int
+}
+
+func (c *coverageCounts) add(other coverageCounts) {
+	c.linesCovered += other.linesCovered
+	c.linesValid += other.linesValid
+	c.branchesCovered += other.branchesCovered
+	c.branchesValid += other.branchesValid
+}
+
+func (c coverageCounts) lineRate() string {
+	return coverageRate(c.linesCovered, c.linesValid)
+}
+
+func (c coverageCounts) branchRate() string {
+	return coverageRate(c.branchesCovered, c.branchesValid)
+}
+
+func coverageRate(covered, valid int) string {
+	if valid == 0 {
+		return "1"
+	}
+	return strconv.FormatFloat(float64(covered)/float64(valid), 'f', 4, 64)
+}
+
+// writeCobertura converts the JaCoCo report into a Cobertura report, with a class per source file.
+// JaCoCo does not count the executions of a line, covered lines have a single hit.
+func writeCobertura(report jacocoReport, sources []string, w io.Writer) error {
+	cobertura := coberturaCoverage{Complexity: "0", Version: "inco", Sources: []string{}}
+	for _, source := range sources {
+		abs, err := filepath.Abs(source)
+		if err != nil {
+			return err
+		}
+		cobertura.Sources = append(cobertura.Sources, filepath.ToSlash(abs))
+	}
+	if len(report.Sessions) > 0 {
+		cobertura.Timestamp = report.Sessions[0].Dump
+	}
+	var total coverageCounts
+	for _, pkg := range report.Packages {
+		coberturaPkg := coberturaPackage{Name: strings.ReplaceAll(pkg.Name, "/", "."), Complexity: "0"}
+		var pkgCounts coverageCounts
+		for _, file := range pkg.SourceFiles {
+			class := coberturaClass{
+				Name:       strings.ReplaceAll(strings.TrimSuffix(pkg.sourcePath(file), path.Ext(file.Name)), "/", "."),
+				Filename:   pkg.sourcePath(file),
+				Complexity: "0",
+			}
+			var counts coverageCounts
+			for _, line := range file.Lines {
+				coberturaLine := coberturaLine{Number: line.Number}
+				counts.linesValid++
+				if line.CI > 0 {
+					coberturaLine.Hits = 1
+					counts.linesCovered++
+				}
+				if branches := line.MB + line.CB; branches > 0 {
+					coberturaLine.Branch = true
+					coberturaLine.ConditionCoverage = fmt.Sprintf("%d%% (%d/%d)", 100*line.CB/branches, line.CB, branches)
+					counts.branchesValid += branches
+					counts.branchesCovered += line.CB
+				}
+				class.Lines = append(class.Lines, coberturaLine)
+			}
+			class.LineRate, class.BranchRate = counts.lineRate(), counts.branchRate()
+			coberturaPkg.Classes = append(coberturaPkg.Classes, class)
+			pkgCounts.add(counts)
+		}
+		coberturaPkg.LineRate, coberturaPkg.BranchRate = pkgCounts.lineRate(), pkgCounts.branchRate()
+		cobertura.Packages = append(cobertura.Packages, coberturaPkg)
+		total.add(pkgCounts)
+	}
+	cobertura.LineRate, cobertura.BranchRate = total.lineRate(), total.branchRate()
+	cobertura.LinesCovered, cobertura.LinesValid = total.linesCovered, total.linesValid
+	cobertura.BranchesCovered, cobertura.BranchesValid = total.branchesCovered, total.branchesValid
+
+	if _, err := io.WriteString(w, xml.Header+coberturaDoctype+"\n"); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(cobertura); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
@@ -0,0 +1,154 @@
+package internal
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// jacocoXML is a JaCoCo report of script1.groovy: 2 lines covered out of 3, 1 branch covered out of 2.
+const jacocoXML = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<!DOCTYPE report PUBLIC "-//JACOCO//DTD Report 1.1//EN" "report.dtd">
+<report name="inco">
+  <sessioninfo id="host-1" start="1700000000000" dump="1700000001000"/>
+  <package name="">
+    <class name="script1" sourcefilename="script1.groovy">
+      <counter type="LINE" missed="1" covered="2"/>
+    </class>
+    <sourcefile name="script1.groovy">
+      <line nr="3" mi="0" ci="4" mb="1" cb="1"/>
+      <line nr="4" mi="2" ci="0" mb="0" cb="0"/>
+      <line nr="6" mi="0" ci="3" mb="0" cb="0"/>
+      <counter type="LINE" missed="1" covered="2"/>
+    </sourcefile>
+  </package>
+</report>
+`
+
+// fakeJaCoCo creates a JaCoCo distribution directory and sets JACOCO_HOME.
+func fakeJaCoCo(t *testing.T) string {
+	home := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(home, "lib"), 0o755))
+	for _, jar := range []string{jacocoAgentJar, jacocoCLIJar} {
+		require.NoError(t, os.WriteFile(filepath.Join(home, filepath.FromSlash(jar)), nil, 0o644))
+	}
+	t.Setenv("JACOCO_HOME", home)
+	return home
+}
+
+func TestCoverageAgent(t *testing.T) {
+	home := fakeJaCoCo(t)
+	dir := t.TempDir()
+	t.Chdir(dir)
+	require.NoError(t, os.MkdirAll(filepath.Join("coverage", "classes"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join("coverage", "jacoco.exec"), []byte("stale"), 0o644))
+
+	agent, err := CoverageAgent(CoverageOptions{}, []Script{
+		{ID: "script1", Type: ResourceTypeGroovy, Path: "src/script1.groovy"},
+		{ID: "mapping", Type: ResourceTypeXSLT, Path: "src/mapping.xsl"},
+		{ID: "script1", Type: ResourceTypeGroovy, Path: "src/script1.groovy"},
+	})
+	require.NoError(t, err)
+	coverage := filepath.Join(dir, "coverage")
+	require.Equal(t, "-javaagent:"+filepath.Join(home, "lib", "jacocoagent.jar")+
+		"=destfile="+filepath.Join(coverage, "jacoco.exec")+
+		",append=true,inclnolocationclasses=true,classdumpdir="+filepath.Join(coverage, "classes")+
+		",includes=script1:script1$*:*.script1:*.script1$*", agent)
+	require.NoFileExists(t, filepath.Join(coverage, "jacoco.exec"))
+	require.NoDirExists(t, filepath.Join(coverage, "classes"))
+
+	t.Run("NoGroovyScript", func(t *testing.T) {
+		_, err := CoverageAgent(CoverageOptions{}, []Script{{ID: "mapping", Type: ResourceTypeXSLT, Path: "src/mapping.xsl"}})
+		require.ErrorContains(t, err, "no groovy script")
+	})
+
+	t.Run("MissingJaCoCo", func(t *testing.T) {
+		t.Setenv("JACOCO_HOME", "")
+		_, err := CoverageAgent(CoverageOptions{}, nil)
+		require.ErrorIs(t, err, ErrJaCoCoNotFound)
+
+		_, err = CoverageAgent(CoverageOptions{JaCoCoHome: t.TempDir()}, nil)
+		require.ErrorIs(t, err, ErrJaCoCoNotFound)
+		require.ErrorContains(t, err, "lib/jacocoagent.jar not found")
+	})
+}
+
+func TestWriteCoverageReports(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake java is a shell script")
+	}
+	home := fakeJaCoCo(t)
+	// the fake java records its arguments, and writes the JaCoCo XML report given after --xml.
+	bin := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(bin, "java"), []byte(`#!/bin/sh
+echo "$@" > "$(dirname "$0")/args"
+while [ "$1" != --xml ]; do shift; done
+cp "$(dirname "$0")/jacoco.xml" "$2"
+`), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(bin, "jacoco.xml"), []byte(jacocoXML), 0o644))
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+	t.Setenv("JAVA_HOME", "")
+	dir := t.TempDir()
+	t.Chdir(dir)
+	scripts := []Script{
+		{ID: "script1", Type: ResourceTypeGroovy, Path: "src/script1.groovy"},
+		{ID: "script2", Type: ResourceTypeGroovy, Path: "src/script2.groovy"},
+	}
+	opts := CoverageOptions{Dir: "out"}
+
+	_, err := WriteCoverageReports(t.Context(), opts, scripts, io.Discard, io.Discard)
+	require.ErrorContains(t, err, "no data recorded")
+
+	require.NoError(t, os.MkdirAll("out", 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join("out", "jacoco.exec"), nil, 0o644))
+	coverages, err := WriteCoverageReports(t.Context(), opts, scripts, io.Discard, io.Discard)
+	require.NoError(t, err)
+	require.Equal(t, []ScriptCoverage{{Path: "src/script1.groovy", Covered: 2, Missed: 1}, {Path: "src/script2.groovy"}}, coverages)
+
+	args, err := os.ReadFile(filepath.Join(bin, "args"))
+	require.NoError(t, err)
+	require.Equal(t, "-jar "+filepath.Join(home, "lib", "jacococli.jar")+" report out/jacoco.exec --classfiles out/classes --html out/html --xml out/jacoco.xml --name inco --sourcefiles src\n", string(args))
+
+	cobertura, err := os.ReadFile(filepath.Join("out", "cobertura.xml"))
+	require.NoError(t, err)
+	require.Equal(t, `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE coverage SYSTEM "http://cobertura.sourceforge.net/xml/coverage-04.dtd">
+<coverage line-rate="0.6667" branch-rate="0.5000" lines-covered="2" lines-valid="3" branches-covered="1" branches-valid="2" complexity="0" version="inco" timestamp="1700000001000">
+  <sources>
+    <source>`+filepath.ToSlash(filepath.Join(dir, "src"))+`</source>
+  </sources>
+  <packages>
+    <package name="" line-rate="0.6667" branch-rate="0.5000" complexity="0">
+      <classes>
+        <class name="script1" filename="script1.groovy" line-rate="0.6667" branch-rate="0.5000" complexity="0">
+          <methods></methods>
+          <lines>
+            <line number="3" hits="1" branch="true" condition-coverage="50% (1/2)"></line>
+            <line number="4" hits="0" branch="false"></line>
+            <line number="6" hits="1" branch="false"></line>
+          </lines>
+        </class>
+      </classes>
+    </package>
+  </packages>
+</coverage>
+`, string(cobertura))
+}
+
+func TestCheckCoverage(t *testing.T) {
+	coverages := []ScriptCoverage{
+		{Path: "src/script1.groovy", Covered: 8, Missed: 2},
+		{Path: "src/script2.groovy", Covered: 1, Missed: 3},
+		{Path: "src/script3.groovy"},
+	}
+	require.NoError(t, CheckCoverage(coverages, 0))
+	require.NoError(t, CheckCoverage(coverages[:1], 80))
+
+	err := CheckCoverage(coverages, 80)
+	require.ErrorIs(t, err, ErrCoverageBelowMinimum)
+	require.Equal(t, "line coverage below the minimum 80.0%: src/script2.groovy 25.0%, src/script3.groovy 0.0%", err.Error())
+}
@@ -0,0 +1,38 @@
+package com.sap.gateway.ip.core.customdev.util
+
+/**
+ * Local stand-in of the CPI message given to processData, see inco.stubs.SimulatedMessage.
+ */
+interface Message {
+    Object getBody()
+
+    public <T> T getBody(Class<T> type)
+
+    void setBody(Object body)
+
+    long getBodySize()
+
+    Map<String, Object> getHeaders()
+
+    public <T> T getHeader(String name, Class<T> type)
+
+    void setHeader(String name, Object value)
+
+    void setHeaders(Map<String, Object> headers)
+
+    Map<String, Object> getProperties()
+
+    Object getProperty(String name)
+
+    void setProperty(String name, Object value)
+
+    void setProperties(Map<String, Object> properties)
+
+    Map<String, Object> getAttachments()
+
+    void setAttachments(Map<String, Object> attachments)
+
+    void addAttachmentObject(String id, Object attachment)
+
+    long getAttachmentsSize()
+}
@@ -0,0 +1,46 @@
+package com.sap.it.api.msglog
+
+/**
+ * Local stand-in of the CPI message processing log, recording what the script logs.
+ */
+class MessageLog {
+    final Map<String, Object> properties = new LinkedHashMap<String, Object>()
+    final Map<String, String> attachments = new LinkedHashMap<String, String>()
+    final List<List<String>> customHeaderProperties = new ArrayList<List<String>>()
+
+    void setStringProperty(String name, String value) {
+        properties.put(name, value)
+    }
+
+    void setIntegerProperty(String name, Integer value) {
+        properties.put(name, value)
+    }
+
+    void setLongProperty(String name, Long value) {
+        properties.put(name, value)
+    }
+
+    void setBooleanProperty(String name, Boolean value) {
+        properties.put(name, value)
+    }
+
+    void setFloatProperty(String name, Float value) {
+        properties.put(name, value)
+    }
+
+    void setDoubleProperty(String name, Double value) {
+        properties.put(name, value)
+    }
+
+    void setDateProperty(String name, Date value) {
+        properties.put(name, value)
+    }
+
+    void addAttachmentAsString(String name, String text, String mediaType) {
+        attachments.put(name, text)
+    }
+
+    void addCustomHeaderProperty(String name, String value) {
+        customHeaderProperties.add([name, value])
+    }
+}
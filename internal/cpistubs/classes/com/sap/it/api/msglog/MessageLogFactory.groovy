@@ -0,0 +1,17 @@
+package com.sap.it.api.msglog
+
+/**
+ * Local stand-in of the messageLogFactory binding, one log per message.
+ */
+class MessageLogFactory {
+    final Map<Object, MessageLog> logs = new IdentityHashMap<Object, MessageLog>()
+
+    MessageLog getMessageLog(Object message) {
+        MessageLog log = logs.get(message)
+        if (log == null) {
+            log = new MessageLog()
+            logs.put(message, log)
+        }
+        return log
+    }
+}
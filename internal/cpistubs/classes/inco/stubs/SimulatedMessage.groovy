@@ -0,0 +1,138 @@
+package inco.stubs
+
+import com.sap.gateway.ip.core.customdev.util.Message
+
+import java.lang.reflect.InvocationTargetException
+import java.lang.reflect.Method
+import java.lang.reflect.Proxy
+import java.nio.charset.StandardCharsets
+
+/**
+ * Local CPI message holding the body, headers, properties and attachments.
+ * Scripts are given the Message of newMessage: a Java proxy, so that `message.body` and `message.properties`
+ * resolve to the getters as on the tenant rather than to the getProperty and setProperty of a groovy object.
+ */
+class SimulatedMessage implements Message {
+    static Message newMessage() {
+        SimulatedMessage message = new SimulatedMessage()
+        return (Message) Proxy.newProxyInstance(Message.classLoader, [Message] as Class[], { Object proxy, Method method, Object[] args ->
+            try {
+                return method.invoke(message, args)
+            } catch (InvocationTargetException e) {
+                throw e.cause
+            }
+        })
+    }
+
+    private Object body
+    private Map<String, Object> headers = new TreeMap<String, Object>(String.CASE_INSENSITIVE_ORDER)
+    private Map<String, Object> properties = new LinkedHashMap<String, Object>()
+    private Map<String, Object> attachments = new LinkedHashMap<String, Object>()
+
+    Object getBody() {
+        return body
+    }
+
+    /**
+     * Converts the body like the CPI type converters do for String, byte[], InputStream and Reader.
+     */
+    public <T> T getBody(Class<T> type) {
+        if (body == null || type.isInstance(body)) {
+            return (T) body
+        }
+        byte[] bytes = bodyBytes()
+        if (type == String) {
+            return (T) new String(bytes, StandardCharsets.UTF_8)
+        }
+        if (type.isArray() && type.componentType == Byte.TYPE) {
+            return (T) bytes
+        }
+        if (type == InputStream) {
+            return (T) new ByteArrayInputStream(bytes)
+        }
+        if (type == Reader) {
+            return (T) new InputStreamReader(new ByteArrayInputStream(bytes), StandardCharsets.UTF_8)
+        }
+        return type.cast(body)
+    }
+
+    private byte[] bodyBytes() {
+        if (body instanceof byte[]) {
+            return (byte[]) body
+        }
+        if (body instanceof InputStream) {
+            body = ((InputStream) body).bytes
+            return (byte[]) body
+        }
+        if (body instanceof Reader) {
+            body = ((Reader) body).text
+        }
+        return body.toString().getBytes(StandardCharsets.UTF_8)
+    }
+
+    void setBody(Object body) {
+        this.body = body
+    }
+
+    long getBodySize() {
+        return body == null ? 0 : bodyBytes().length
+    }
+
+    Map<String, Object> getHeaders() {
+        return headers
+    }
+
+    public <T> T getHeader(String name, Class<T> type) {
+        Object value = headers.get(name)
+        if (value == null || type.isInstance(value)) {
+            return (T) value
+        }
+        if (type == String) {
+            return (T) value.toString()
+        }
+        return type.cast(value)
+    }
+
+    void setHeader(String name, Object value) {
+        headers.put(name, value)
+    }
+
+    void setHeaders(Map<String, Object> headers) {
+        this.headers.clear()
+        this.headers.putAll(headers)
+    }
+
+    Map<String, Object> getProperties() {
+        return properties
+    }
+
+    Object getProperty(String name) {
+        return properties.get(name)
+    }
+
+    void setProperty(String name, Object value) {
+        properties.put(name, value)
+    }
+
+    void setProperties(Map<String, Object> properties) {
+        this.properties.clear()
+        this.properties.putAll(properties)
+    }
+
+    Map<String, Object> getAttachments() {
+        return attachments
+    }
+
+    void setAttachments(Map<String, Object> attachments) {
+        this.attachments.clear()
+        this.attachments.putAll(attachments)
+    }
+
+    void addAttachmentObject(String id, Object attachment) {
+        attachments.put(id, attachment)
+    }
+
+    long getAttachmentsSize() {
+        return attachments.size()
+    }
+}
@@ -0,0 +1,145 @@
+import com.sap.gateway.ip.core.customdev.util.Message
+import com.sap.it.api.msglog.MessageLogFactory
+import inco.stubs.SimulatedMessage
+import groovy.json.JsonOutput
+import groovy.json.JsonSlurper
+
+// Runs the declarative test cases of a CPI script, given as the JSON spec written by inco.
+// Results are printed as a JUnit platform tree, one node per case.
+
+def spec = new JsonSlurper().parse(new File(args[0]), 'UTF-8')
+def out = new PrintStream(System.out, true, 'UTF-8')
+
+def results = []
+spec.cases.each { testCase ->
+    List<String> problems
+    try {
+        def binding = new Binding()
+        binding.setVariable('messageLogFactory', new MessageLogFactory())
+        def script = new GroovyShell(this.class.classLoader, binding).parse(new File(spec.script))
+        def message = SimulatedMessage.newMessage()
+        message.setBody(testCase.body)
+        message.setHeaders(testCase.headers ?: [:])
+        message.setProperties(testCase.properties ?: [:])
+        def result = script.invokeMethod(testCase.function ?: spec.function, message)
+        problems = compareMessage(testCase.expected ?: [:], result instanceof Message ? result : message)
+    } catch (Throwable e) {
+        problems = [(e.class.name + ': ' + e.message).toString()]
+    }
+    results << [name: testCase.name, problems: problems]
+}
+
+def failures = results.count { !it.problems.isEmpty() }
+out.println('╷')
+out.println("└─ ${spec.name} ${failures ? '✘' : '✔'}")
+results.eachWithIndex { result, i ->
+    def prefix = i == results.size() - 1 ? '   └─ ' : '   ├─ '
+    if (result.problems.isEmpty()) {
+        out.println("${prefix}${result.name} ✔")
+        return
+    }
+    out.println("${prefix}${result.name} ✘ ${result.problems[0]}")
+    result.problems.drop(1).each { out.println("         ${it}") }
+}
+out.flush()
+System.exit(failures ? 1 : 0)
+
+List<String> compareMessage(Map expected, Message message) {
+    List<String> problems = []
+    if (expected.body != null) {
+        def actual = message.getBody(String)
+        if (actual != expected.body) {
+            problems << "body: expected ${quote(expected.body)} but was ${quote(actual)}".toString()
+        }
+    }
+    compareValues('header', expected.headers ?: [:], message.getHeaders(), problems)
+    compareValues('property', expected.properties ?: [:], message.getProperties(), problems)
+    (expected.assertions ?: []).each { assertion ->
+        def problem = checkAssertion(assertion, message)
+        if (problem != null) {
+            problems << problem
+        }
+    }
+    return problems
+}
+
+// checkAssertion returns the problem of the assertion on the message, null when it holds.
+String checkAssertion(Map assertion, Message message) {
+    String label
+    Object actual
+    try {
+        if (assertion.header) {
+            label = "header ${assertion.header}"
+            actual = message.getHeader(assertion.header, Object)
+        } else if (assertion.property) {
+            label = "property ${assertion.property}"
+            actual = message.getProperty(assertion.property)
+        } else if (assertion.xpath) {
+            label = "xpath ${assertion.xpath}"
+            def document = javax.xml.parsers.DocumentBuilderFactory.newInstance().newDocumentBuilder()
+                    .parse(new org.xml.sax.InputSource(new StringReader(message.getBody(String) ?: '')))
+            actual = javax.xml.xpath.XPathFactory.newInstance().newXPath().evaluate(assertion.xpath, document)
+        } else if (assertion.jsonPath) {
+            label = "jsonPath ${assertion.jsonPath}"
+            actual = jsonPath(new JsonSlurper().parseText(message.getBody(String) ?: 'null'), assertion.jsonPath)
+        } else {
+            label = 'body'
+            actual = message.getBody(String)
+        }
+    } catch (Exception e) {
+        return "${label}: ${e.class.name}: ${e.message}".toString()
+    }
+    def value = actual instanceof Map || actual instanceof List ? JsonOutput.toJson(actual) : actual
+    if (assertion['equals'] != null) {
+        if (value == null || String.valueOf(value) != assertion['equals']) {
+            return "${label}: expected ${quote(assertion['equals'])} but was ${value == null ? 'absent' : quote(value)}".toString()
+        }
+    } else if (value == null || !(String.valueOf(value) =~ assertion.matches).find()) {
+        return "${label}: expected to match ${quote(assertion.matches)} but was ${value == null ? 'absent' : quote(value)}".toString()
+    }
+    return null
+}
+
+// jsonPath evaluates the subset of JSONPath made of `$`, `.name`, `['name']` and `[index]` steps.
+Object jsonPath(Object document, String path) {
+    def matcher = path.substring(1) =~ /\.([^.\[]+)|\[(\d+)\]|\['([^']*)'\]/
+    def value = document
+    int end = 0
+    while (matcher.find()) {
+        if (matcher.start() != end) {
+            throw new IllegalArgumentException("unsupported JSONPath ${path}")
+        }
+        end = matcher.end()
+        def index = matcher.group(2)
+        if (index != null) {
+            value = value instanceof List && value.size() > (index as int) ? value[index as int] : null
+        } else {
+            def name = matcher.group(1) ?: matcher.group(3)
+            value = value instanceof Map ? value[name] : null
+        }
+    }
+    if (end != path.length() - 1) {
+        throw new IllegalArgumentException("unsupported JSONPath ${path}")
+    }
+    return value
+}
+
+// compareValues checks the expected values only, a null expected value must be absent.
+void compareValues(String kind, Map expected, Map actual, List<String> problems) {
+    expected.each { name, value ->
+        def present = actual.containsKey(name) && actual.get(name) != null
+        if (value == null) {
+            if (present) {
+                problems << "${kind} ${name}: expected absent but was ${quote(actual.get(name))}".toString()
+            }
+        } else if (!present) {
+            problems << "${kind} ${name}: expected ${quote(value)} but was absent".toString()
+        } else if (String.valueOf(actual.get(name)) != String.valueOf(value)) {
+            problems << "${kind} ${name}: expected ${quote(value)} but was ${quote(actual.get(name))}".toString()
+        }
+    }
+}
+
+String quote(Object value) {
+    return JsonOutput.toJson(String.valueOf(value))
+}
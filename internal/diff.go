@@ -0,0 +1,139 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/pmezard/go-difflib/difflib"
+)
+
+// DiffSummary counts scripts by comparison outcome.
+type DiffSummary struct {
+	Changed   int
+	Added     int
+	Removed   int
+	Unchanged int
+}
+
+func (s DiffSummary) String() string {
+	return fmt.Sprintf("%d changed, %d added, %d removed, %d unchanged", s.Changed, s.Added, s.Removed, s.Unchanged)
+}
+
+// DiffScripts authenticates over oauth2, then writes a unified diff between tenant and local scripts.
+// Scripts missing on the tenant are reported as added, tenant resources of a manifest type
+// which are not referenced by the manifest are reported as removed.
+func DiffScripts(ctx context.Context, client IBTPClient, readFile func(string) ([]byte, error), iflows []Iflow, w io.Writer) (DiffSummary, error) {
+	var summary DiffSummary
+	if err := client.RequestToken(ctx); err != nil {
+		return summary, fmt.Errorf("RequestToken: %w", err)
+	}
+
+	for _, iflow := range iflows {
+		for _, script := range iflow.Scripts {
+			local, err := readFile(script.Path)
+			if err != nil {
+				return summary, fmt.Errorf("reading %s: %w", script.Path, err)
+			}
+			remote, err := client.GetIflowResource(ctx, iflow, script)
+			if errors.Is(err, ErrResourceNotFound) {
+				summary.Added++
+				if err := writeUnifiedDiff(w, nil, local, "/dev/null", script.Path); err != nil {
+					return summary, err
+				}
+				continue
+			}
+			if err != nil {
+				return summary, fmt.Errorf("GetIflowResource %s: %w", script.ID, err)
+			}
+			if bytes.Equal(local, remote) {
+				summary.Unchanged++
+				continue
+			}
+			summary.Changed++
+			if err := writeUnifiedDiff(w, remote, local, tenantPath(iflow, script.ID), script.Path); err != nil {
+				return summary, err
+			}
+		}
+
+		removed, err := unreferencedResources(ctx, client, iflow)
+		if err != nil {
+			return summary, err
+		}
+		for _, resource := range removed {
+			summary.Removed++
+			remote, err := client.GetIflowResource(ctx, iflow, Script{ID: resource.Name, Type: resource.ResourceType})
+			if err != nil {
+				return summary, fmt.Errorf("GetIflowResource %s: %w", resource.Name, err)
+			}
+			if err := writeUnifiedDiff(w, remote, nil, tenantPath(iflow, resource.Name), "/dev/null"); err != nil {
+				return summary, err
+			}
+		}
+	}
+	return summary, nil
+}
+
+// scriptChanged tells whether data differs from the tenant content of the script.
+// A script missing on the tenant is reported as changed.
+func scriptChanged(ctx context.Context, client IBTPClient, iflow Iflow, script Script, data []byte) (bool, error) {
+	remote, err := client.GetIflowResource(ctx, iflow, script)
+	if errors.Is(err, ErrResourceNotFound) {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return !bytes.Equal(remote, data), nil
+}
+
+// unreferencedResources lists the iflow resources of a manifest type which are not referenced by a script.
+func unreferencedResources(ctx context.Context, client IBTPClient, iflow Iflow) ([]Resource, error) {
+	types := map[string]bool{}
+	referenced := map[Resource]bool{}
+	for _, script := range iflow.Scripts {
+		types[script.Type] = true
+		referenced[Resource{Name: script.ID, ResourceType: script.Type}] = true
+	}
+	resources, err := client.ListIflowResources(ctx, iflow)
+	if err != nil {
+		return nil, fmt.Errorf("ListIflowResources %s: %w", iflow.ID, err)
+	}
+	var unreferenced []Resource
+	for _, resource := range resources {
+		if types[resource.ResourceType] && !referenced[resource] {
+			unreferenced = append(unreferenced, resource)
+		}
+	}
+	return unreferenced, nil
+}
+
+func tenantPath(iflow Iflow, name string) string {
+	return fmt.Sprintf("tenant/%s/%s", iflow.ID, name)
+}
+
+func writeUnifiedDiff(w io.Writer, from, to []byte, fromFile, toFile string) error {
+	return difflib.WriteUnifiedDiff(w, difflib.UnifiedDiff{
+		A:        splitLines(from),
+		B:        splitLines(to),
+		FromFile: fromFile,
+		ToFile:   toFile,
+		Context:  3,
+	})
+}
+
+// splitLines splits data after each line feed, the last line always ends with a line feed.
+func splitLines(data []byte) []string {
+	if len(data) == 0 {
+		return nil
+	}
+	lines := strings.SplitAfter(string(data), "\n")
+	if lines[len(lines)-1] == "" {
+		return lines[:len(lines)-1]
+	}
+	lines[len(lines)-1] += "\n"
+	return lines
+}
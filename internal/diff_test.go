@@ -0,0 +1,61 @@
+package internal
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiffScripts(t *testing.T) {
+	iflows := []Iflow{{ID: "iflow1", Version: "active", Scripts: []Script{
+		{ID: "same.groovy", Type: "groovy", Path: "src/same.groovy"},
+		{ID: "changed.groovy", Type: "groovy", Path: "src/changed.groovy"},
+		{ID: "new.groovy", Type: "groovy", Path: "src/new.groovy"},
+	}}}
+	readFile := func(path string) ([]byte, error) {
+		switch path {
+		case "src/same.groovy":
+			return []byte("same\n"), nil
+		case "src/changed.groovy":
+			return []byte("line1\nline2 local\n"), nil
+		case "src/new.groovy":
+			return []byte("new\n"), nil
+		}
+		return nil, fmt.Errorf("not found")
+	}
+	t.Run("FailingRequestToken", func(t *testing.T) {
+		mockedClient := BTPClientMock{requestTokenError: ErrUnexpectedStatusCode}
+		_, err := DiffScripts(t.Context(), &mockedClient, readFile, iflows, &bytes.Buffer{})
+		require.ErrorIs(t, err, ErrUnexpectedStatusCode)
+	})
+	t.Run("FailingReadFile", func(t *testing.T) {
+		_, err := DiffScripts(t.Context(), &BTPClientMock{}, readFile, []Iflow{{ID: "iflow1", Scripts: []Script{{ID: "x", Path: "missing"}}}}, &bytes.Buffer{})
+		require.ErrorContains(t, err, "reading missing")
+	})
+	t.Run("Valid", func(t *testing.T) {
+		mockedClient := BTPClientMock{
+			resources: map[string][]byte{
+				"same.groovy":    []byte("same\n"),
+				"changed.groovy": []byte("line1\nline2 tenant\n"),
+				"old.groovy":     []byte("old\n"),
+			},
+			listedResources: []Resource{
+				{Name: "same.groovy", ResourceType: "groovy"},
+				{Name: "changed.groovy", ResourceType: "groovy"},
+				{Name: "old.groovy", ResourceType: "groovy"},
+				{Name: "mapping.xsl", ResourceType: "xslt"},
+			},
+		}
+		out := &bytes.Buffer{}
+		summary, err := DiffScripts(t.Context(), &mockedClient, readFile, iflows, out)
+		require.NoError(t, err)
+		require.Equal(t, DiffSummary{Changed: 1, Added: 1, Removed: 1, Unchanged: 1}, summary)
+		require.Equal(t, "1 changed, 1 added, 1 removed, 1 unchanged", summary.String())
+		require.Contains(t, out.String(), "--- tenant/iflow1/changed.groovy\n+++ src/changed.groovy\n@@ -1,2 +1,2 @@\n line1\n-line2 tenant\n+line2 local\n")
+		require.Contains(t, out.String(), "--- /dev/null\n+++ src/new.groovy\n@@ -0,0 +1 @@\n+new\n")
+		require.Contains(t, out.String(), "--- tenant/iflow1/old.groovy\n+++ /dev/null\n@@ -1 +0,0 @@\n-old\n")
+		require.NotContains(t, out.String(), "mapping.xsl")
+	})
+}
@@ -0,0 +1,99 @@
+package internal
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/goccy/go-yaml"
+)
+
+const resourcesDir = "src/main/resources/"
+
+// ExportIflow authenticates over oauth2, downloads the iflow artifact and unzips it into out.
+// It returns the manifest entry of the iflow, with one script per known resource type.
+func ExportIflow(ctx context.Context, client IBTPClient, writeFile func(string, []byte) error, iflow Iflow, out string) (Iflow, error) {
+	if err := client.RequestToken(ctx); err != nil {
+		return Iflow{}, fmt.Errorf("RequestToken: %w", err)
+	}
+	content, err := client.DownloadIflowArtifact(ctx, iflow)
+	if err != nil {
+		return Iflow{}, fmt.Errorf("DownloadIflowArtifact: %w", err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(content), int64(len(content)))
+	if err != nil {
+		return Iflow{}, fmt.Errorf("%w: %v", ErrInvalidArtifact, err)
+	}
+
+	entry := Iflow{ID: iflow.ID, Version: iflow.Version}
+	files := append([]*zip.File(nil), zr.File...)
+	sort.Slice(files, func(i, j int) bool { return files[i].Name < files[j].Name })
+	for _, f := range files {
+		if f.FileInfo().IsDir() {
+			continue
+		}
+		name := path.Clean(strings.ReplaceAll(f.Name, "\\", "/"))
+		if !fs.ValidPath(name) {
+			return Iflow{}, fmt.Errorf("%w: unsafe entry %q", ErrInvalidArtifact, f.Name)
+		}
+		data, err := readZipFile(f)
+		if err != nil {
+			return Iflow{}, err
+		}
+		localPath := filepath.Join(out, filepath.FromSlash(name))
+		if err := writeFile(localPath, data); err != nil {
+			return Iflow{}, err
+		}
+		fmt.Printf("EXPORTED %s\n", localPath)
+		if !strings.HasPrefix(name, resourcesDir) {
+			continue
+		}
+		if resourceType, ok := resourceTypeExtensions[strings.ToLower(path.Ext(name))]; ok {
+			entry.Scripts = append(entry.Scripts, Script{ID: path.Base(name), Type: resourceType, Path: filepath.ToSlash(localPath)})
+		}
+	}
+	return entry, nil
+}
+
+func readZipFile(f *zip.File) ([]byte, error) {
+	r, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(r)
+}
+
+// MergeIflow returns cfg with the exported iflow replacing the iflow of the same id, or appended.
+// The tests of the replaced scripts are kept, along with the other iflows and settings.
+func MergeIflow(cfg Config, iflow Iflow) Config {
+	i := slices.IndexFunc(cfg.UploadScripts, func(existing Iflow) bool { return existing.ID == iflow.ID })
+	if i < 0 {
+		cfg.UploadScripts = append(slices.Clone(cfg.UploadScripts), iflow)
+		return cfg
+	}
+	existing := cfg.UploadScripts[i]
+	iflow.Deploy = existing.Deploy
+	iflow.Scripts = slices.Clone(iflow.Scripts)
+	for j, script := range iflow.Scripts {
+		if k := slices.IndexFunc(existing.Scripts, func(s Script) bool { return s.ID == script.ID }); k >= 0 {
+			iflow.Scripts[j].Tests = existing.Scripts[k].Tests
+		}
+	}
+	cfg.UploadScripts = slices.Clone(cfg.UploadScripts)
+	cfg.UploadScripts[i] = iflow
+	return cfg
+}
+
+// MarshalConfig encodes the manifest.
+func MarshalConfig(cfg Config) ([]byte, error) {
+	return yaml.MarshalWithOptions(cfg, yaml.IndentSequence(true))
+}
@@ -0,0 +1,126 @@
+package internal
+
+import (
+	"archive/zip"
+	"bytes"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/goccy/go-yaml"
+	"github.com/stretchr/testify/require"
+)
+
+func zipEntries(t *testing.T, entries map[string]string) []byte {
+	archive := &bytes.Buffer{}
+	zw := zip.NewWriter(archive)
+	for name, content := range entries {
+		w, err := zw.Create(name)
+		require.NoError(t, err)
+		_, err = w.Write([]byte(content))
+		require.NoError(t, err)
+	}
+	require.NoError(t, zw.Close())
+	return archive.Bytes()
+}
+
+func TestExportIflow(t *testing.T) {
+	t.Run("FailingRequestToken", func(t *testing.T) {
+		mockedClient := BTPClientMock{requestTokenError: ErrUnexpectedStatusCode}
+		_, err := ExportIflow(t.Context(), &mockedClient, nil, Iflow{ID: "iflow1", Version: "active"}, "out")
+		require.ErrorIs(t, err, ErrUnexpectedStatusCode)
+	})
+	t.Run("NotFound", func(t *testing.T) {
+		_, err := ExportIflow(t.Context(), &BTPClientMock{}, nil, Iflow{ID: "iflow1", Version: "active"}, "out")
+		require.ErrorIs(t, err, ErrArtifactNotFound)
+	})
+	t.Run("UnsafeEntry", func(t *testing.T) {
+		mockedClient := BTPClientMock{artifact: zipEntries(t, map[string]string{"../evil.groovy": "x"})}
+		_, err := ExportIflow(t.Context(), &mockedClient, func(string, []byte) error { return nil }, Iflow{ID: "iflow1", Version: "active"}, "out")
+		require.ErrorIs(t, err, ErrInvalidArtifact)
+	})
+	t.Run("Valid", func(t *testing.T) {
+		mockedClient := BTPClientMock{artifact: zipEntries(t, map[string]string{
+			"META-INF/MANIFEST.MF": "Bundle-Name: Iflow One\n",
+			"src/main/resources/scenarioflows/integrationflow/iflow1.iflw": "<iflow/>",
+			"src/main/resources/script/b.groovy":                           "b",
+			"src/main/resources/script/a.groovy":                           "a",
+			"src/main/resources/mapping/m.xsl":                             "<xsl/>",
+			"src/main/resources/parameters.prop":                           "",
+		})}
+		written := map[string]string{}
+		iflow, err := ExportIflow(t.Context(), &mockedClient, func(path string, data []byte) error {
+			written[path] = string(data)
+			return nil
+		}, Iflow{ID: "iflow1", Version: "active"}, "out")
+		require.NoError(t, err)
+		require.Len(t, written, 6)
+		require.Equal(t, "b", written["out/src/main/resources/script/b.groovy"])
+		require.Equal(t, Iflow{ID: "iflow1", Version: "active", Scripts: []Script{
+			{ID: "m.xsl", Type: ResourceTypeXSLT, Path: "out/src/main/resources/mapping/m.xsl"},
+			{ID: "a.groovy", Type: ResourceTypeGroovy, Path: "out/src/main/resources/script/a.groovy"},
+			{ID: "b.groovy", Type: ResourceTypeGroovy, Path: "out/src/main/resources/script/b.groovy"},
+		}}, iflow)
+	})
+}
+
+func TestMarshalConfig(t *testing.T) {
+	data, err := MarshalConfig(Config{UploadScripts: []Iflow{{ID: "iflow1", Version: "active", Scripts: []Script{{ID: "a.groovy", Type: "groovy", Path: "out/a.groovy"}}}}})
+	require.NoError(t, err)
+	require.Equal(t, `testPaths: []
+uploadScripts:
+  - id: iflow1
+    version: active
+    scripts:
+      - id: a.groovy
+        type: groovy
+        path: out/a.groovy
+`, string(data))
+}
+
+func TestMergeIflow(t *testing.T) {
+	cfg := Config{
+		TestPaths: []string{"tests/*.groovy"},
+		UploadScripts: []Iflow{
+			{ID: "iflow1", Version: "1.0.0", Deploy: true, Scripts: []Script{
+				{ID: "a.groovy", Type: ResourceTypeGroovy, Path: "src/a.groovy", Tests: []MessageCase{{Name: "case1"}}},
+				{ID: "old.groovy", Type: ResourceTypeGroovy, Path: "src/old.groovy"},
+			}},
+			{ID: "iflow2", Version: "active"},
+		},
+		Test:        TestOptions{Timeout: time.Minute},
+		Concurrency: 2,
+	}
+	exported := Iflow{ID: "iflow1", Version: "active", Scripts: []Script{
+		{ID: "a.groovy", Type: ResourceTypeGroovy, Path: "out/a.groovy"},
+		{ID: "b.groovy", Type: ResourceTypeGroovy, Path: "out/b.groovy"},
+	}}
+
+	merged := MergeIflow(cfg, exported)
+	require.Equal(t, Config{
+		TestPaths: []string{"tests/*.groovy"},
+		UploadScripts: []Iflow{
+			{ID: "iflow1", Version: "active", Deploy: true, Scripts: []Script{
+				{ID: "a.groovy", Type: ResourceTypeGroovy, Path: "out/a.groovy", Tests: []MessageCase{{Name: "case1"}}},
+				{ID: "b.groovy", Type: ResourceTypeGroovy, Path: "out/b.groovy"},
+			}},
+			{ID: "iflow2", Version: "active"},
+		},
+		Test:        TestOptions{Timeout: time.Minute},
+		Concurrency: 2,
+	}, merged)
+	require.Equal(t, "src/a.groovy", cfg.UploadScripts[0].Scripts[0].Path)
+	require.Empty(t, exported.Scripts[0].Tests)
+
+	merged = MergeIflow(cfg, Iflow{ID: "iflow3", Version: "active"})
+	require.Equal(t, append(slices.Clone(cfg.UploadScripts), Iflow{ID: "iflow3", Version: "active"}), merged.UploadScripts)
+
+	// the merged manifest keeps its settings once encoded.
+	data, err := MarshalConfig(MergeIflow(cfg, exported))
+	require.NoError(t, err)
+	var decoded Config
+	require.NoError(t, yaml.Unmarshal(data, &decoded))
+	require.Equal(t, time.Minute, decoded.Test.Timeout)
+	require.Equal(t, 2, decoded.Concurrency)
+	require.Equal(t, []MessageCase{{Name: "case1"}}, decoded.UploadScripts[0].Scripts[0].Tests)
+}
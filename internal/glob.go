@@ -0,0 +1,175 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+var ErrNoTestMatch = errors.New("matches no test script")
+
+// testScriptExtension selects the test scripts of a directory entry, along with the case files.
+const testScriptExtension = ".groovy"
+
+// ExpandTestPaths expands the testPaths entries into test script paths.
+// An entry is a file, a directory standing for its groovy files and case files, or a glob pattern where `**`
+// matches any number of directories. Entries starting with `!` exclude the matching paths.
+// Every entry expands in sorted order, and it is an error when an entry matches nothing once excluded.
+func ExpandTestPaths(entries []string) ([]string, error) {
+	exclusions := testPathExclusions(entries)
+	var paths []string
+	seen := map[string]bool{}
+	for _, entry := range entries {
+		if strings.HasPrefix(entry, "!") {
+			continue
+		}
+		matches, err := expandIncludedTestPath(entry, exclusions)
+		if err != nil {
+			return nil, err
+		}
+		for _, match := range matches {
+			if !seen[match] {
+				seen[match] = true
+				paths = append(paths, match)
+			}
+		}
+	}
+	return paths, nil
+}
+
+// testPathExclusions returns the slash separated patterns of the `!` entries.
+func testPathExclusions(entries []string) []string {
+	var exclusions []string
+	for _, entry := range entries {
+		if exclusion, ok := strings.CutPrefix(entry, "!"); ok {
+			exclusions = append(exclusions, filepath.ToSlash(exclusion))
+		}
+	}
+	return exclusions
+}
+
+// expandIncludedTestPath returns the sorted test scripts of a single entry which are not excluded.
+func expandIncludedTestPath(entry string, exclusions []string) ([]string, error) {
+	matches, err := expandTestPath(entry)
+	if err != nil {
+		return nil, err
+	}
+	matches = slices.DeleteFunc(matches, func(p string) bool {
+		return slices.ContainsFunc(exclusions, func(exclusion string) bool {
+			// an excluded directory excludes everything below it.
+			return matchGlob(exclusion, filepath.ToSlash(p)) || matchGlob(exclusion+"/**", filepath.ToSlash(p))
+		})
+	})
+	if len(matches) == 0 {
+		return nil, fmt.Errorf("%q %w once excluded", entry, ErrNoTestMatch)
+	}
+	return matches, nil
+}
+
+// expandTestPath returns the sorted test scripts of a single entry.
+func expandTestPath(entry string) ([]string, error) {
+	pattern := filepath.ToSlash(entry)
+	if !hasGlobMeta(pattern) {
+		info, err := os.Stat(entry)
+		if err != nil {
+			return nil, fmt.Errorf("%q does not exist", entry)
+		}
+		if !info.IsDir() {
+			return []string{entry}, nil
+		}
+		pattern = strings.TrimSuffix(pattern, "/") + "/**/*"
+	}
+	matches, err := globFiles(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("%q: %w", entry, err)
+	}
+	if pattern != filepath.ToSlash(entry) {
+		matches = slices.DeleteFunc(matches, func(p string) bool {
+			return !strings.HasSuffix(p, testScriptExtension) && !isCaseFile(p)
+		})
+	}
+	if len(matches) == 0 {
+		return nil, fmt.Errorf("%q %w", entry, ErrNoTestMatch)
+	}
+	return matches, nil
+}
+
+// globFiles returns the sorted regular files matching the slash separated pattern.
+func globFiles(pattern string) ([]string, error) {
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, err
+	}
+
+	root := globRoot(pattern)
+	var matches []string
+	err := filepath.WalkDir(filepath.FromSlash(root), func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if p == filepath.FromSlash(root) {
+				return fs.SkipAll
+			}
+			return err
+		}
+		if d.Type().IsRegular() && matchGlob(pattern, path.Clean(filepath.ToSlash(p))) {
+			matches = append(matches, p)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	slices.Sort(matches)
+	return matches, nil
+}
+
+// globRoot returns the deepest directory of the slash separated pattern without glob meta characters.
+func globRoot(pattern string) string {
+	segments := strings.Split(pattern, "/")
+	root := ""
+	for len(segments) > 1 && !hasGlobMeta(segments[0]) {
+		root = path.Join(root, segments[0])
+		segments = segments[1:]
+	}
+	if root == "" {
+		root = "."
+	}
+	if strings.HasPrefix(pattern, "/") {
+		root = "/" + root
+	}
+	return root
+}
+
+func hasGlobMeta(pattern string) bool {
+	return strings.ContainsAny(pattern, "*?[")
+}
+
+// matchGlob reports whether the slash separated name matches pattern,
+// where a `**` segment matches zero or more path segments.
+func matchGlob(pattern, name string) bool {
+	return matchSegments(strings.Split(path.Clean(pattern), "/"), strings.Split(path.Clean(name), "/"))
+}
+
+func matchSegments(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(name); i++ {
+				if matchSegments(pattern[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], name[0]); !ok {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
@@ -0,0 +1,94 @@
+package internal
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestExpandTestPaths(t *testing.T) {
+	dir := t.TempDir()
+	t.Chdir(dir)
+	for _, file := range []string{
+		"runTests.groovy",
+		"tests/AddTest.groovy",
+		"tests/helpers.groovy",
+		"tests/mapping/MapTest.groovy",
+		"tests/mapping/deep/DeepTest.groovy",
+		"tests/mapping/map.cases.yaml",
+		"tests/slow/SlowTest.groovy",
+		"tests/data/input.xml",
+	} {
+		require.NoError(t, os.MkdirAll(filepath.Dir(file), 0o755))
+		require.NoError(t, os.WriteFile(file, []byte(`def x`), 0o644))
+	}
+	slash := func(paths []string) []string {
+		for i := range paths {
+			paths[i] = filepath.ToSlash(paths[i])
+		}
+		return paths
+	}
+
+	testCases := []struct {
+		name     string
+		entries  []string
+		expected []string
+	}{
+		{name: "File", entries: []string{"runTests.groovy"}, expected: []string{"runTests.groovy"}},
+		{name: "Glob", entries: []string{"tests/*Test.groovy"}, expected: []string{"tests/AddTest.groovy"}},
+		{name: "DoubleStar", entries: []string{"tests/**/*Test.groovy"}, expected: []string{
+			"tests/AddTest.groovy", "tests/mapping/MapTest.groovy", "tests/mapping/deep/DeepTest.groovy", "tests/slow/SlowTest.groovy",
+		}},
+		{name: "Directory", entries: []string{"tests/mapping"}, expected: []string{
+			"tests/mapping/MapTest.groovy", "tests/mapping/deep/DeepTest.groovy", "tests/mapping/map.cases.yaml",
+		}},
+		{name: "Exclusions", entries: []string{"tests", "!tests/slow", "!**/helpers.groovy", "!**/*.cases.yaml"}, expected: []string{
+			"tests/AddTest.groovy", "tests/mapping/MapTest.groovy", "tests/mapping/deep/DeepTest.groovy",
+		}},
+		{name: "KeepsEntryOrder", entries: []string{"runTests.groovy", "tests/mapping/**/*.groovy", "tests/**/MapTest.groovy"}, expected: []string{
+			"runTests.groovy", "tests/mapping/MapTest.groovy", "tests/mapping/deep/DeepTest.groovy",
+		}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			paths, err := ExpandTestPaths(tc.entries)
+			require.NoError(t, err)
+			require.Equal(t, tc.expected, slash(paths))
+		})
+	}
+
+	t.Run("NoMatch", func(t *testing.T) {
+		_, err := ExpandTestPaths([]string{"tests/**/*Spec.groovy"})
+		require.ErrorIs(t, err, ErrNoTestMatch)
+		_, err = ExpandTestPaths([]string{"renamed/*.groovy"})
+		require.ErrorIs(t, err, ErrNoTestMatch)
+		_, err = ExpandTestPaths([]string{"tests/data"})
+		require.ErrorIs(t, err, ErrNoTestMatch)
+		_, err = ExpandTestPaths([]string{"missing.groovy"})
+		require.EqualError(t, err, `"missing.groovy" does not exist`)
+	})
+
+	t.Run("AllExcluded", func(t *testing.T) {
+		_, err := ExpandTestPaths([]string{"runTests.groovy", "tests/slow/*Test.groovy", "!tests/slow"})
+		require.ErrorIs(t, err, ErrNoTestMatch)
+		require.EqualError(t, err, `"tests/slow/*Test.groovy" matches no test script once excluded`)
+		_, err = ExpandTestPaths([]string{"!**/*.cases.yaml", "tests/mapping/*.cases.yaml"})
+		require.ErrorIs(t, err, ErrNoTestMatch)
+	})
+
+	t.Run("BadPattern", func(t *testing.T) {
+		_, err := ExpandTestPaths([]string{"tests/[*.groovy"})
+		require.Error(t, err)
+	})
+}
+
+func TestMatchGlob(t *testing.T) {
+	require.True(t, matchGlob("**/*.groovy", "a.groovy"))
+	require.True(t, matchGlob("a/**/b/*.groovy", "a/b/c.groovy"))
+	require.True(t, matchGlob("a/**/b/*.groovy", "a/x/y/b/c.groovy"))
+	require.False(t, matchGlob("a/**/b/*.groovy", "a/x/y/c.groovy"))
+	require.True(t, matchGlob("./a/*.groovy", "a/c.groovy"))
+	require.False(t, matchGlob("a/*.groovy", "a/b/c.groovy"))
+}
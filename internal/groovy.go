@@ -0,0 +1,174 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+var ErrGroovyNotFound = errors.New("groovy not found")
+
+// javaOptsEnv is the environment variable giving the JVM options to groovy.
+const javaOptsEnv = "JAVA_OPTS"
+
+// defaultClasspath is the classpath of the test scripts when none is configured.
+var defaultClasspath = []string{"src"}
+
+// groovyCommand is the groovy invocation shared by every test script.
+type groovyCommand struct {
+	binary    string
+	classpath string
+	env       []string
+	dir       string
+	// stubs is the directory of the extracted CPI stubs and case file harness.
+	stubs string
+	// scripts resolve the script ids of the case files, whose specs are written into specs.
+	scripts []Script
+	specs   string
+}
+
+// newGroovyCommand resolves the groovy binary, the classpath and the environment of opts.
+func newGroovyCommand(opts TestOptions) (groovyCommand, error) {
+	binary, err := lookupGroovy(opts.GroovyBinary)
+	if err != nil {
+		return groovyCommand{}, err
+	}
+	// relative paths are resolved from the current directory, whatever the working directory.
+	classpath, err := expandClasspath(opts.Classpath, opts.WorkingDir != "")
+	if err != nil {
+		return groovyCommand{}, err
+	}
+	stubs, err := extractCPIStubs()
+	if err != nil {
+		return groovyCommand{}, fmt.Errorf("extracting CPI stubs: %w", err)
+	}
+	// the CPI stubs come last, classes of the configured classpath take precedence.
+	classpath += string(os.PathListSeparator) + filepath.Join(stubs, cpiStubsClasses)
+	env := os.Environ()
+	// a JAVA_OPTS of the test env is completed by the JVM options, the coverage agent included.
+	var javaOpts []string
+	if opts.Env[javaOptsEnv] != "" {
+		javaOpts = append(javaOpts, opts.Env[javaOptsEnv])
+	}
+	if javaOpts = append(javaOpts, opts.JVMOpts...); len(javaOpts) > 0 {
+		env = append(env, javaOptsEnv+"="+strings.Join(javaOpts, " "))
+	}
+	for _, key := range slices.Sorted(maps.Keys(opts.Env)) {
+		if key != javaOptsEnv {
+			env = append(env, key+"="+opts.Env[key])
+		}
+	}
+	return groovyCommand{binary: binary, classpath: classpath, env: env, dir: opts.WorkingDir, stubs: stubs}, nil
+}
+
+// command returns the command running the groovy script at path with args.
+func (g groovyCommand) command(ctx context.Context, path string, args ...string) *exec.Cmd {
+	if g.dir != "" {
+		if abs, err := filepath.Abs(path); err == nil {
+			path = abs
+		}
+	}
+	var cmdArgs []string
+	if g.classpath != "" {
+		cmdArgs = append(cmdArgs, "-cp", g.classpath)
+	}
+	cmdArgs = append(cmdArgs, path)
+	cmd := exec.CommandContext(ctx, g.binary, append(cmdArgs, args...)...)
+	cmd.Env = g.env
+	cmd.Dir = g.dir
+	return cmd
+}
+
+// testCommand returns the command running the test script of target,
+// or the harness when target is a case file or the tests of a script.
+func (g groovyCommand) testCommand(ctx context.Context, target testTarget) (*exec.Cmd, error) {
+	var spec string
+	var err error
+	switch {
+	case target.script != nil:
+		spec, err = writeScriptTestsSpec(*target.script, g.specs)
+	case isCaseFile(target.path):
+		spec, err = writeCaseSpec(target.path, g.scripts, g.specs)
+	default:
+		return g.command(ctx, target.path), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return g.command(ctx, filepath.Join(g.stubs, cpiStubsHarness), spec), nil
+}
+
+// lookupGroovy returns the configured groovy binary, else the one of GROOVY_HOME, else the one in PATH.
+func lookupGroovy(binary string) (string, error) {
+	if binary != "" {
+		path, err := exec.LookPath(binary)
+		if err != nil {
+			return "", fmt.Errorf("%w: test.groovyBinary %q: %v", ErrGroovyNotFound, binary, err)
+		}
+		return path, nil
+	}
+	if home := os.Getenv("GROOVY_HOME"); home != "" {
+		path, err := exec.LookPath(filepath.Join(home, "bin", "groovy"))
+		if err != nil {
+			return "", fmt.Errorf("%w in GROOVY_HOME %q: %v", ErrGroovyNotFound, home, err)
+		}
+		return path, nil
+	}
+	path, err := exec.LookPath("groovy")
+	if err != nil {
+		return "", fmt.Errorf("%w: set test.groovyBinary or GROOVY_HOME, or add groovy to PATH", ErrGroovyNotFound)
+	}
+	return path, nil
+}
+
+// expandClasspath joins the classpath entries, glob patterns are expanded to the matching files.
+func expandClasspath(entries []string, absolute bool) (string, error) {
+	if len(entries) == 0 {
+		entries = defaultClasspath
+	}
+	var paths []string
+	for _, entry := range entries {
+		matches := []string{entry}
+		if hasGlobMeta(filepath.ToSlash(entry)) {
+			var err error
+			matches, err = globFiles(filepath.ToSlash(entry))
+			if err != nil {
+				return "", fmt.Errorf("classpath %q: %w", entry, err)
+			}
+			if len(matches) == 0 {
+				return "", fmt.Errorf("classpath %q matches no file", entry)
+			}
+		}
+		for _, match := range matches {
+			if absolute {
+				abs, err := filepath.Abs(match)
+				if err != nil {
+					return "", err
+				}
+				match = abs
+			}
+			paths = append(paths, match)
+		}
+	}
+	return strings.Join(paths, string(os.PathListSeparator)), nil
+}
+
+// groovyScripts returns the groovy scripts, each path once.
+func groovyScripts(scripts []Script) []Script {
+	var groovy []Script
+	for _, script := range scripts {
+		if script.Type != ResourceTypeGroovy {
+			continue
+		}
+		if !slices.ContainsFunc(groovy, func(s Script) bool { return s.Path == script.Path }) {
+			groovy = append(groovy, script)
+		}
+	}
+	return groovy
+}
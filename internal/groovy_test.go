@@ -0,0 +1,98 @@
+package internal
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLookupGroovy(t *testing.T) {
+	fakeGroovy(t, "exit 0\n")
+	path, err := lookupGroovy("")
+	require.NoError(t, err)
+	require.Equal(t, "groovy", filepath.Base(path))
+
+	home := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(home, "bin"), 0o755))
+	t.Setenv("GROOVY_HOME", home)
+	_, err = lookupGroovy("")
+	require.ErrorIs(t, err, ErrGroovyNotFound)
+	require.ErrorContains(t, err, "GROOVY_HOME")
+	require.NoError(t, os.WriteFile(filepath.Join(home, "bin", "groovy"), []byte("#!/bin/sh\n"), 0o755))
+	path, err = lookupGroovy("")
+	require.NoError(t, err)
+	require.Equal(t, filepath.Join(home, "bin", "groovy"), path)
+
+	path, err = lookupGroovy(filepath.Join(home, "bin", "groovy"))
+	require.NoError(t, err)
+	require.Equal(t, filepath.Join(home, "bin", "groovy"), path)
+	_, err = lookupGroovy(filepath.Join(home, "groovy-4"))
+	require.ErrorIs(t, err, ErrGroovyNotFound)
+	require.ErrorContains(t, err, "test.groovyBinary")
+
+	t.Setenv("GROOVY_HOME", "")
+	t.Setenv("PATH", t.TempDir())
+	_, err = lookupGroovy("")
+	require.ErrorIs(t, err, ErrGroovyNotFound)
+	require.ErrorContains(t, err, "PATH")
+}
+
+func TestExpandClasspath(t *testing.T) {
+	dir := t.TempDir()
+	t.Chdir(dir)
+	for _, file := range []string{"lib/b.jar", "lib/a.jar", "lib/notes.txt"} {
+		require.NoError(t, os.MkdirAll(filepath.Dir(file), 0o755))
+		require.NoError(t, os.WriteFile(file, nil, 0o644))
+	}
+	separator := string(os.PathListSeparator)
+
+	classpath, err := expandClasspath(nil, false)
+	require.NoError(t, err)
+	require.Equal(t, "src", classpath)
+
+	classpath, err = expandClasspath([]string{"src", "lib/*.jar"}, false)
+	require.NoError(t, err)
+	require.Equal(t, strings.Join([]string{"src", filepath.Join("lib", "a.jar"), filepath.Join("lib", "b.jar")}, separator), classpath)
+
+	classpath, err = expandClasspath([]string{"src"}, true)
+	require.NoError(t, err)
+	require.Equal(t, filepath.Join(dir, "src"), classpath)
+
+	_, err = expandClasspath([]string{"libs/*.jar"}, false)
+	require.ErrorContains(t, err, `classpath "libs/*.jar" matches no file`)
+}
+
+func TestExecuteTestsGroovyCommand(t *testing.T) {
+	fakeGroovy(t, "echo \"$@\"\necho \"$JAVA_OPTS|$CPI_ENV\"\npwd\n")
+	dir := t.TempDir()
+	t.Chdir(dir)
+	work := filepath.Join(dir, "work")
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "lib"), 0o755))
+	require.NoError(t, os.MkdirAll(work, 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "lib", "a.jar"), nil, 0o644))
+
+	results, err := ExecuteTests(t.Context(), []string{"a.groovy"}, nil, io.Discard, io.Discard, TestOptions{
+		Timeout:    time.Minute,
+		Classpath:  []string{"src", "lib/*.jar"},
+		JVMOpts:    []string{"-Xmx512m", "-Dfile.encoding=UTF-8"},
+		Env:        map[string]string{"CPI_ENV": "dev", "JAVA_OPTS": "-Xss4m"},
+		WorkingDir: work,
+	})
+	require.NoError(t, err)
+	require.True(t, TestsPassed(results))
+	// the working directory may be reported through symlinks.
+	work, err = filepath.EvalSymlinks(work)
+	require.NoError(t, err)
+	stubs, err := extractCPIStubs()
+	require.NoError(t, err)
+	classpath := strings.Join([]string{filepath.Join(dir, "src"), filepath.Join(dir, "lib", "a.jar"), filepath.Join(stubs, cpiStubsClasses)}, string(os.PathListSeparator))
+	require.Equal(t, "-cp "+classpath+" "+filepath.Join(dir, "a.groovy")+"\n-Xss4m -Xmx512m -Dfile.encoding=UTF-8|dev\n"+work+"\n", results[0].Stdout)
+
+	_, err = ExecuteTests(t.Context(), []string{"a.groovy"}, nil, io.Discard, io.Discard, TestOptions{GroovyBinary: "missing-groovy"})
+	require.ErrorIs(t, err, ErrGroovyNotFound)
+}
@@ -0,0 +1,257 @@
+package internal
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Lint rules, named by the findings and by the `inco:ignore` comments disabling them.
+const (
+	LintRuleCompile     = "compile"
+	LintRuleProcessData = "processData"
+	LintRulePrintln     = "println"
+	LintRuleBodyString  = "body-string"
+)
+
+var (
+	processDataRegexp = regexp.MustCompile(`\bprocessData\s*\(`)
+	printlnRegexp     = regexp.MustCompile(`(^|[^\w.])(println|printf|print)\b|\bSystem\.(out|err)\.`)
+	bodyStringRegexp  = regexp.MustCompile(`\bgetBody\s*\(\s*(java\.lang\.)?String(\.class)?\s*\)`)
+	// ignoreRegexp disables rules on its line and the next one: `// inco:ignore println, body-string`.
+	ignoreRegexp = regexp.MustCompile(`inco:ignore\s+([\w-]+(?:\s*,\s*[\w-]+)*)`)
+	// groovycErrorRegexp is an error of groovyc: `/src/script1.groovy: 3: unexpected token: } @ line 3, column 1.`
+	groovycErrorRegexp = regexp.MustCompile(`^(.+?): (\d+): (.*?)(?: @ line \d+, column (\d+)\.)?$`)
+)
+
+// LintFinding is a problem of a groovy script.
+type LintFinding struct {
+	Path   string
+	Line   int
+	Column int
+	Rule   string
+	// Error findings fail the lint, the others are warnings.
+	Error   bool
+	Message string
+}
+
+func (f LintFinding) String() string {
+	location := f.Path
+	if f.Line > 0 {
+		location += ":" + strconv.Itoa(f.Line)
+		if f.Column > 0 {
+			location += ":" + strconv.Itoa(f.Column)
+		}
+	}
+	severity := "warning"
+	if f.Error {
+		severity = "error"
+	}
+	return fmt.Sprintf("%s: %s: %s [%s]", location, severity, f.Message, f.Rule)
+}
+
+// LintFailed tells whether a finding is an error.
+func LintFailed(findings []LintFinding) bool {
+	return slices.ContainsFunc(findings, func(f LintFinding) bool { return f.Error })
+}
+
+// LintScripts checks the groovy scripts for the CPI pitfalls, then compiles them with groovyc
+// against the classpath of the tests, CPI stubs included.
+// The static findings are returned along with the error when groovyc cannot run.
+func LintScripts(ctx context.Context, scripts []Script, opts TestOptions) ([]LintFinding, error) {
+	scripts = groovyScripts(scripts)
+	var findings []LintFinding
+	for _, script := range scripts {
+		data, err := os.ReadFile(script.Path)
+		if err != nil {
+			return findings, err
+		}
+		findings = append(findings, lintSource(script.Path, data)...)
+	}
+	if len(scripts) == 0 {
+		return findings, nil
+	}
+	compileFindings, err := compileScripts(ctx, scripts, opts)
+	findings = append(findings, compileFindings...)
+	slices.SortStableFunc(findings, func(a, b LintFinding) int {
+		if a.Path != b.Path {
+			return strings.Compare(a.Path, b.Path)
+		}
+		return a.Line - b.Line
+	})
+	return findings, err
+}
+
+// lintSource reports the CPI pitfalls of the script source, comments aside.
+func lintSource(path string, data []byte) []LintFinding {
+	var findings []LintFinding
+	// ignored are the rules disabled by line, fileIgnored are all the rules disabled in the file.
+	ignored := map[int][]string{}
+	var fileIgnored []string
+	hasProcessData := false
+	inComment := false
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(nil, max(len(data)+1, bufio.MaxScanTokenSize))
+	for number := 1; scanner.Scan(); number++ {
+		line := scanner.Text()
+		if match := ignoreRegexp.FindStringSubmatch(line); match != nil {
+			for rule := range strings.SplitSeq(match[1], ",") {
+				rule = strings.TrimSpace(rule)
+				ignored[number] = append(ignored[number], rule)
+				ignored[number+1] = append(ignored[number+1], rule)
+				fileIgnored = append(fileIgnored, rule)
+			}
+		}
+		var code string
+		code, inComment = stripComments(line, inComment)
+		report := func(rule, message string) {
+			if !slices.Contains(ignored[number], rule) {
+				findings = append(findings, LintFinding{Path: path, Line: number, Rule: rule, Message: message})
+			}
+		}
+		if processDataRegexp.MatchString(code) {
+			hasProcessData = true
+		}
+		if printlnRegexp.MatchString(code) {
+			report(LintRulePrintln, "console output is lost on the tenant, write to the message log instead")
+		}
+		if bodyStringRegexp.MatchString(code) {
+			report(LintRuleBodyString, "reading the body as String copies the whole payload in memory, prefer a java.io.Reader on large payloads")
+		}
+	}
+	// a file wide rule is disabled by an ignore comment anywhere in the file.
+	if !hasProcessData && !slices.Contains(fileIgnored, LintRuleProcessData) {
+		findings = append(findings, LintFinding{
+			Path:    path,
+			Line:    1,
+			Rule:    LintRuleProcessData,
+			Message: "no processData function, the function called by default by the script step",
+		})
+	}
+	return findings
+}
+
+// stripComments removes the comments and blanks the string contents of the line,
+// inComment tells a block comment is open. Strings spanning several lines are not tracked.
+func stripComments(line string, inComment bool) (string, bool) {
+	var code strings.Builder
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case inComment:
+			if strings.HasPrefix(line[i:], "*/") {
+				inComment = false
+				i++
+			}
+		case quote != 0:
+			if c == '\\' && i+1 < len(line) {
+				code.WriteString("  ")
+				i++
+			} else if c == quote {
+				code.WriteByte(c)
+				quote = 0
+			} else {
+				code.WriteByte(' ')
+			}
+		case c == '"' || c == '\'':
+			quote = c
+			code.WriteByte(c)
+		case strings.HasPrefix(line[i:], "//"):
+			return code.String(), false
+		case strings.HasPrefix(line[i:], "/*"):
+			inComment = true
+			i++
+		default:
+			code.WriteByte(c)
+		}
+	}
+	return code.String(), inComment
+}
+
+// compileScripts compiles the scripts with the groovyc next to the groovy binary, and reports the compilation errors.
+// Scripts of the same file name are compiled separately, as they compile to the same class.
+func compileScripts(ctx context.Context, scripts []Script, opts TestOptions) ([]LintFinding, error) {
+	groovy, err := newGroovyCommand(opts)
+	if err != nil {
+		return nil, err
+	}
+	groovyc, err := exec.LookPath(filepath.Join(filepath.Dir(groovy.binary), "groovyc"))
+	if err != nil {
+		return nil, fmt.Errorf("%w: groovyc not found next to %s", ErrGroovyNotFound, groovy.binary)
+	}
+	output, err := os.MkdirTemp("", "inco-lint-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(output)
+
+	var batches [][]Script
+	for _, script := range scripts {
+		i := slices.IndexFunc(batches, func(batch []Script) bool {
+			return !slices.ContainsFunc(batch, func(s Script) bool { return filepath.Base(s.Path) == filepath.Base(script.Path) })
+		})
+		if i < 0 {
+			batches = append(batches, nil)
+			i = len(batches) - 1
+		}
+		batches[i] = append(batches[i], script)
+	}
+
+	var findings []LintFinding
+	for _, batch := range batches {
+		args := []string{"-cp", groovy.classpath, "-d", output}
+		paths := map[string]string{}
+		for _, script := range batch {
+			abs, err := filepath.Abs(script.Path)
+			if err != nil {
+				return findings, err
+			}
+			paths[abs] = script.Path
+			args = append(args, abs)
+		}
+		cmd := exec.CommandContext(ctx, groovyc, args...)
+		cmd.Env = groovy.env
+		out, err := cmd.CombinedOutput()
+		if err == nil {
+			continue
+		}
+		if ctx.Err() != nil {
+			return findings, ctx.Err()
+		}
+		batchFindings := parseGroovycErrors(string(out), paths)
+		if len(batchFindings) == 0 {
+			return findings, fmt.Errorf("groovyc: %w\n%s", err, out)
+		}
+		findings = append(findings, batchFindings...)
+	}
+	return findings, nil
+}
+
+// parseGroovycErrors returns the errors of the groovyc output, paths maps the compiled files to the script paths.
+func parseGroovycErrors(output string, paths map[string]string) []LintFinding {
+	var findings []LintFinding
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		match := groovycErrorRegexp.FindStringSubmatch(strings.TrimRight(scanner.Text(), "\r"))
+		if match == nil {
+			continue
+		}
+		path, ok := paths[match[1]]
+		if !ok {
+			continue
+		}
+		line, _ := strconv.Atoi(match[2])
+		column, _ := strconv.Atoi(match[4])
+		findings = append(findings, LintFinding{Path: path, Line: line, Column: column, Rule: LintRuleCompile, Error: true, Message: match[3]})
+	}
+	return findings
+}
@@ -0,0 +1,110 @@
+package internal
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLintSource(t *testing.T) {
+	t.Run("Clean", func(t *testing.T) {
+		require.Empty(t, lintSource("a.groovy", []byte(`import com.sap.gateway.ip.core.customdev.util.Message
+
+def Message processData(Message message) {
+    def reader = message.getBody(java.io.Reader)
+    messageLogFactory.getMessageLog(message).setStringProperty("status", "println")
+    return message
+}
+`)))
+	})
+
+	t.Run("Pitfalls", func(t *testing.T) {
+		findings := lintSource("a.groovy", []byte(`def transform(message) {
+    println "transforming"
+    def body = message.getBody(String)
+    System.out.print(body)
+    def xml = message.getBody(java.lang.String.class) // println in a comment
+    /* println
+       getBody(String) */
+    return message
+}
+`))
+		require.Equal(t, []LintFinding{
+			{Path: "a.groovy", Line: 2, Rule: LintRulePrintln, Message: "console output is lost on the tenant, write to the message log instead"},
+			{Path: "a.groovy", Line: 3, Rule: LintRuleBodyString, Message: "reading the body as String copies the whole payload in memory, prefer a java.io.Reader on large payloads"},
+			{Path: "a.groovy", Line: 4, Rule: LintRulePrintln, Message: "console output is lost on the tenant, write to the message log instead"},
+			{Path: "a.groovy", Line: 5, Rule: LintRuleBodyString, Message: "reading the body as String copies the whole payload in memory, prefer a java.io.Reader on large payloads"},
+			{Path: "a.groovy", Line: 1, Rule: LintRuleProcessData, Message: "no processData function, the function called by default by the script step"},
+		}, findings)
+		require.Equal(t, "a.groovy:2: warning: console output is lost on the tenant, write to the message log instead [println]", findings[0].String())
+	})
+
+	t.Run("Ignored", func(t *testing.T) {
+		require.Empty(t, lintSource("a.groovy", []byte(`// inco:ignore processData
+def transform(message) {
+    // small payloads only, inco:ignore body-string, println
+    println message.getBody(String)
+    println "done" // inco:ignore println
+    return message
+}
+`)))
+	})
+}
+
+func TestParseGroovycErrors(t *testing.T) {
+	output := `org.codehaus.groovy.control.MultipleCompilationErrorsException: startup failed:
+/work/src/script1.groovy: 3: Unexpected input: '}' @ line 3, column 1.
+   }
+   ^
+
+/work/src/script1.groovy: 7: unable to resolve class Foo
+/work/other.groovy: 1: ignored
+
+2 errors
+`
+	require.Equal(t, []LintFinding{
+		{Path: "src/script1.groovy", Line: 3, Column: 1, Rule: LintRuleCompile, Error: true, Message: "Unexpected input: '}'"},
+		{Path: "src/script1.groovy", Line: 7, Rule: LintRuleCompile, Error: true, Message: "unable to resolve class Foo"},
+	}, parseGroovycErrors(output, map[string]string{"/work/src/script1.groovy": "src/script1.groovy"}))
+}
+
+func TestLintScripts(t *testing.T) {
+	fakeGroovy(t, "")
+	groovy, err := exec.LookPath("groovy")
+	require.NoError(t, err)
+	// the fake groovyc fails the scripts containing "broken", printing the error of their first line.
+	require.NoError(t, os.WriteFile(filepath.Join(filepath.Dir(groovy), "groovyc"), []byte(`#!/bin/sh
+status=0
+for f in "$@"; do
+  if grep -q broken "$f" 2>/dev/null; then echo "$f: 1: unexpected token: broken @ line 1, column 5."; status=1; fi
+done
+exit $status
+`), 0o755))
+	dir := t.TempDir()
+	t.Chdir(dir)
+	require.NoError(t, os.MkdirAll("src/other", 0o755))
+	require.NoError(t, os.WriteFile("src/script1.groovy", []byte("def processData(message) { message }\n"), 0o644))
+	require.NoError(t, os.WriteFile("src/other/script1.groovy", []byte("def broken\ndef processData(message) { println message }\n"), 0o644))
+
+	findings, err := LintScripts(t.Context(), []Script{
+		{ID: "script1", Type: ResourceTypeGroovy, Path: "src/script1.groovy"},
+		{ID: "other", Type: ResourceTypeGroovy, Path: "src/other/script1.groovy"},
+		{ID: "mapping", Type: ResourceTypeXSLT, Path: "src/mapping.xsl"},
+	}, TestOptions{})
+	require.NoError(t, err)
+	require.Equal(t, []LintFinding{
+		{Path: "src/other/script1.groovy", Line: 1, Column: 5, Rule: LintRuleCompile, Error: true, Message: "unexpected token: broken"},
+		{Path: "src/other/script1.groovy", Line: 2, Rule: LintRulePrintln, Message: "console output is lost on the tenant, write to the message log instead"},
+	}, findings)
+	require.True(t, LintFailed(findings))
+	require.False(t, LintFailed(findings[1:]))
+
+	t.Run("GroovyNotFound", func(t *testing.T) {
+		findings, err := LintScripts(t.Context(), []Script{{ID: "other", Type: ResourceTypeGroovy, Path: "src/other/script1.groovy"}}, TestOptions{GroovyBinary: "missing-groovy"})
+		require.ErrorIs(t, err, ErrGroovyNotFound)
+		require.Len(t, findings, 1)
+	})
+}
@@ -1,58 +1,404 @@
 package internal
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"io"
-	"os/exec"
+	"os"
+	"sync"
 	"time"
 )
 
+var (
+	ErrDeployFailed  = errors.New("deployment failed")
+	ErrDeployTimeout = errors.New("deployment timeout")
+	ErrTestTimeout   = errors.New("test timeout")
+)
+
 const (
-	timeout = time.Second * 10
+	// defaultTestTimeout stops a test script running for too long, when no timeout is configured.
+	defaultTestTimeout = time.Minute * 5
+	// testWaitDelay bounds the wait for the output of a killed test script.
+	testWaitDelay = time.Second
 )
 
-// ExecuteTests run groovy testing scripts.
-func ExecuteTests(paths []string, stdout, stderr io.Writer) bool {
-	status := true
-	for _, path := range paths {
-		cmd := exec.Command("groovy", "-cp", "src", path)
-		cmd.Stdout = stdout
-		cmd.Stderr = stderr
+var (
+	deployPollInterval = time.Second * 5
+	deployTimeout      = time.Minute * 5
+)
+
+// UploadOptions tunes UploadScripts behaviour.
+type UploadOptions struct {
+	// Deploy deploys every iflow having at least one successful upload,
+	// whatever the value of Iflow.Deploy.
+	Deploy bool
+	// OnlyChanged skips scripts whose content is identical on the tenant.
+	OnlyChanged bool
+	// Prune deletes the iflow resources of a manifest type which are not referenced by a script.
+	Prune bool
+	// ConfirmPrune is given the resources to delete, they are deleted only when it returns true.
+	// An error, when the confirmation cannot be asked, fails the prune.
+	// A nil ConfirmPrune deletes them without confirmation.
+	ConfirmPrune func([]IflowResource) (bool, error)
+	// Concurrency is the maximum number of scripts uploaded at the same time, at least one.
+	Concurrency int
+}
+
+// TestOptions tunes ExecuteTests behaviour, it is the test section of the config.
+type TestOptions struct {
+	// Timeout is the maximum duration of a test script, defaultTestTimeout when zero.
+	Timeout time.Duration `yaml:"timeout,omitempty"`
+	// Parallel is the maximum number of test scripts running at the same time, at least one.
+	Parallel int `yaml:"parallel,omitempty"`
+	// GroovyBinary is the groovy executable, looked up in GROOVY_HOME then PATH when empty.
+	GroovyBinary string `yaml:"groovyBinary,omitempty"`
+	// Classpath entries are files, directories or glob patterns, `src` when empty.
+	Classpath []string `yaml:"classpath,omitempty"`
+	// JVMOpts are given to the JVM through JAVA_OPTS.
+	JVMOpts []string `yaml:"jvmOpts,omitempty"`
+	// Env is added to the environment of the test scripts.
+	Env map[string]string `yaml:"env,omitempty"`
+	// WorkingDir is the directory the test scripts run in, the current directory when empty.
+	WorkingDir string `yaml:"workingDir,omitempty"`
+	// Coverage configures the coverage measured by inco test --coverage.
+	Coverage CoverageOptions `yaml:"coverage,omitempty"`
+}
+
+// TestResult is the outcome of a test script.
+type TestResult struct {
+	Path     string
+	Duration time.Duration
+	Stdout   string
+	Stderr   string
+	// ExitCode is -1 when the test script did not exit by itself.
+	ExitCode int
+	// Err is nil when the test script passed.
+	Err error
+	// Cases are the test cases reported by the test script output.
+	Cases []TestCase
+}
+
+// TestsPassed tells whether every test script passed.
+func TestsPassed(results []TestResult) bool {
+	for _, result := range results {
+		if result.Err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// ExecuteTests run groovy testing scripts and case files, then the tests of the scripts, opts.Parallel at a time.
+// Case files refer to scripts by id or by path.
+// A test script still running after the timeout is killed along with its child processes.
+// Running in parallel, the stdout and the stderr of each test script are printed as one block each once it is done.
+func ExecuteTests(ctx context.Context, paths []string, scripts []Script, stdout, stderr io.Writer, opts TestOptions) ([]TestResult, error) {
+	groovy, err := newGroovyCommand(opts)
+	if err != nil {
+		return nil, err
+	}
+	groovy.scripts = scripts
+	if groovy.specs, err = os.MkdirTemp("", "inco-cases-"); err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(groovy.specs)
+	timeout := opts.Timeout
+	if timeout <= 0 {
+		timeout = defaultTestTimeout
+	}
+	targets := testTargets(paths, scripts)
+	results := make([]TestResult, len(targets))
+	if opts.Parallel <= 1 {
+		for i, target := range targets {
+			fmt.Fprintln(stdout, "Running tests: ", target.path)
+			results[i] = executeTest(ctx, groovy, target, stdout, stderr, timeout)
+			printTestStatus(stdout, results[i])
+		}
+		return results, nil
+	}
+
+	var mu sync.Mutex
+	queue := make(chan int)
+	var wg sync.WaitGroup
+	for range min(opts.Parallel, len(targets)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range queue {
+				block, errBlock := &lockedWriter{}, &lockedWriter{}
+				fmt.Fprintln(block, "Running tests: ", targets[i].path)
+				results[i] = executeTest(ctx, groovy, targets[i], block, errBlock, timeout)
+				printTestStatus(block, results[i])
+				mu.Lock()
+				stdout.Write(block.buf.Bytes())
+				stderr.Write(errBlock.buf.Bytes())
+				mu.Unlock()
+			}
+		}()
+	}
+	for i := range targets {
+		queue <- i
+	}
+	close(queue)
+	wg.Wait()
+	return results, nil
+}
 
-		fmt.Println("Running tests: ", path)
-		if err := cmd.Run(); err != nil {
-			fmt.Printf("Error tests: %s\n%v\n", path, err)
-			status = false
+// testTarget is a test script, a case file, or the tests of a configured script.
+type testTarget struct {
+	path string
+	// script is set for the tests of a script, path is then the script path.
+	script *Script
+}
+
+// testTargets returns the test paths followed by the scripts having tests, each script once.
+func testTargets(paths []string, scripts []Script) []testTarget {
+	targets := make([]testTarget, 0, len(paths))
+	for _, path := range paths {
+		targets = append(targets, testTarget{path: path})
+	}
+	seen := map[[2]string]bool{}
+	for i := range scripts {
+		script := &scripts[i]
+		key := [2]string{script.ID, script.Path}
+		if len(script.Tests) == 0 || seen[key] {
+			continue
 		}
+		seen[key] = true
+		targets = append(targets, testTarget{path: script.Path, script: script})
+	}
+	return targets
+}
+
+func printTestStatus(w io.Writer, result TestResult) {
+	if errors.Is(result.Err, ErrTestTimeout) {
+		fmt.Fprintf(w, "TIMEOUT tests: %s\n%v\n", result.Path, result.Err)
+	} else if result.Err != nil {
+		fmt.Fprintf(w, "Error tests: %s\n%v\n", result.Path, result.Err)
+	}
+}
+
+// lockedWriter buffers an output of a test script, written concurrently.
+type lockedWriter struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (w *lockedWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.buf.Write(p)
+}
+
+// executeTest runs the test target in its own process group, killed after timeout.
+// The output is written to stdout and stderr, and captured in the result.
+func executeTest(ctx context.Context, groovy groovyCommand, target testTarget, stdout, stderr io.Writer, timeout time.Duration) TestResult {
+	path := target.path
+	testCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	var capturedStdout, capturedStderr bytes.Buffer
+	cmd, err := groovy.testCommand(testCtx, target)
+	if err != nil {
+		return TestResult{Path: path, ExitCode: -1, Err: err}
 	}
-	return status
+	cmd.Stdout = io.MultiWriter(stdout, &capturedStdout)
+	cmd.Stderr = io.MultiWriter(stderr, &capturedStderr)
+	cmd.WaitDelay = testWaitDelay
+	killProcessGroup(cmd)
+
+	start := time.Now()
+	err = cmd.Run()
+	result := TestResult{
+		Path:     path,
+		Duration: time.Since(start),
+		Stdout:   capturedStdout.String(),
+		Stderr:   capturedStderr.String(),
+		ExitCode: -1,
+		Err:      err,
+	}
+	if cmd.ProcessState != nil {
+		result.ExitCode = cmd.ProcessState.ExitCode()
+	}
+	if err != nil && ctx.Err() == nil && errors.Is(testCtx.Err(), context.DeadlineExceeded) {
+		result.Err = fmt.Errorf("%w after %s", ErrTestTimeout, timeout)
+	}
+	result.Cases = parseTestCases(result.Stdout)
+	return result
 }
 
 // UploadScripts authenticates over oauth2, then upload iflow scripts.
-func UploadScripts(client IBTPClient, readFile func(string) ([]byte, error), iflows []Iflow) error {
-	if err := client.RequestToken(); err != nil {
+// Iflows with a path are first uploaded as a whole artifact zipped from that directory.
+// Iflows flagged for deployment are deployed once their scripts are uploaded.
+func UploadScripts(ctx context.Context, client IBTPClient, readFile func(string) ([]byte, error), iflows []Iflow, opts UploadOptions) error {
+	if err := client.RequestToken(ctx); err != nil {
 		return fmt.Errorf("RequestToken: %w", err)
 	}
-	if err := client.FetchCSRFToken(); err != nil {
+	if err := client.FetchCSRFToken(ctx); err != nil {
 		return fmt.Errorf("FetchCSRFToken: %w", err)
 	}
 
 	var uploadErr error
-	for _, iflow := range iflows {
-		for _, script := range iflow.Scripts {
-			data, err := readFile(script.Path)
-			if err != nil {
-				fmt.Printf("FAILURE reading %s, %v\n", script.Path, err)
+	// changes counts the successful uploads and deletions of each iflow.
+	changes := make([]int, len(iflows))
+	var jobs []uploadJob
+	for i, iflow := range iflows {
+		if iflow.Path != "" {
+			if err := uploadArtifact(ctx, client, os.DirFS(iflow.Path), iflow); err != nil {
+				fmt.Printf("FAILURE uploading artifact %s, %v\n", iflow.ID, err)
 				uploadErr = fmt.Errorf("some reading/uploading scripts failed")
-				continue
+			} else {
+				fmt.Printf("SUCCESS uploading artifact %s\n", iflow.ID)
+				changes[i]++
 			}
-			if err := client.UpdateIflowResource(data, iflow, script); err != nil {
-				fmt.Printf("FAILURE uploading %s, %v\n", script.ID, err)
-				uploadErr = fmt.Errorf("some reading/uploading scripts failed")
-				continue
-			}
-			fmt.Printf("SUCCESS uploading %s\n", script.ID)
+		}
+		for _, script := range iflow.Scripts {
+			jobs = append(jobs, uploadJob{iflow: i, script: script})
+		}
+	}
+
+	runUploadJobs(ctx, client, readFile, iflows, jobs, opts)
+	// results are reported in the configuration order, whatever the completion order.
+	for _, job := range jobs {
+		fmt.Print(job.output.String())
+		if job.failed {
+			uploadErr = fmt.Errorf("some reading/uploading scripts failed")
+		}
+		if job.uploaded {
+			changes[job.iflow]++
+		}
+	}
+
+	// an interrupted upload is neither pruned nor deployed.
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if opts.Prune {
+		deleted, err := pruneResources(ctx, client, iflows, opts.ConfirmPrune)
+		if err != nil {
+			uploadErr = err
+		}
+		for i := range changes {
+			changes[i] += deleted[i]
 		}
 	}
+
+	for i, iflow := range iflows {
+		if changes[i] == 0 || !(opts.Deploy || iflow.Deploy) {
+			continue
+		}
+		if err := DeployIflow(ctx, client, iflow); err != nil {
+			fmt.Printf("FAILURE deploying %s, %v\n", iflow.ID, err)
+			uploadErr = fmt.Errorf("some deployments failed")
+			continue
+		}
+		fmt.Printf("SUCCESS deploying %s\n", iflow.ID)
+	}
 	return uploadErr
 }
+
+// uploadJob is the upload of a single script, along with its outcome.
+type uploadJob struct {
+	iflow    int
+	script   Script
+	output   bytes.Buffer
+	failed   bool
+	uploaded bool
+}
+
+// runUploadJobs uploads the scripts with at most opts.Concurrency requests in flight.
+func runUploadJobs(ctx context.Context, client IBTPClient, readFile func(string) ([]byte, error), iflows []Iflow, jobs []uploadJob, opts UploadOptions) {
+	workers := opts.Concurrency
+	if workers < 1 {
+		workers = 1
+	}
+	queue := make(chan *uploadJob)
+	var wg sync.WaitGroup
+	for range min(workers, len(jobs)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range queue {
+				uploadScript(ctx, client, readFile, iflows[job.iflow], job, opts)
+			}
+		}()
+	}
+	for i := range jobs {
+		queue <- &jobs[i]
+	}
+	close(queue)
+	wg.Wait()
+}
+
+// uploadScript reads, checks and uploads the script of job, recording the outcome in job.
+func uploadScript(ctx context.Context, client IBTPClient, readFile func(string) ([]byte, error), iflow Iflow, job *uploadJob, opts UploadOptions) {
+	script := job.script
+	data, err := readFile(script.Path)
+	if err != nil {
+		fmt.Fprintf(&job.output, "FAILURE reading %s, %v\n", script.Path, err)
+		job.failed = true
+		return
+	}
+	if err := CheckResource(script, data); err != nil {
+		fmt.Fprintf(&job.output, "FAILURE checking %s, %v\n", script.Path, err)
+		job.failed = true
+		return
+	}
+	if opts.OnlyChanged {
+		changed, err := scriptChanged(ctx, client, iflow, script, data)
+		if err != nil {
+			fmt.Fprintf(&job.output, "FAILURE comparing %s, %v\n", script.ID, err)
+			job.failed = true
+			return
+		}
+		if !changed {
+			fmt.Fprintf(&job.output, "SKIPPED unchanged %s\n", script.ID)
+			return
+		}
+	}
+	if err := client.UpdateIflowResource(ctx, data, iflow, script); err != nil {
+		fmt.Fprintf(&job.output, "FAILURE uploading %s, %v\n", script.ID, err)
+		job.failed = true
+		return
+	}
+	fmt.Fprintf(&job.output, "SUCCESS uploading %s\n", script.ID)
+	job.uploaded = true
+}
+
+// DeployIflow deploys the iflow then polls its runtime status until it is started or in error.
+func DeployIflow(ctx context.Context, client IBTPClient, iflow Iflow) error {
+	// the previous deployment stays visible until the new one is picked up by the runtime.
+	previous, err := client.GetRuntimeArtifact(ctx, iflow.ID)
+	if err != nil && !errors.Is(err, ErrArtifactNotFound) {
+		return fmt.Errorf("GetRuntimeArtifact: %w", err)
+	}
+	if err := client.DeployIflow(ctx, iflow); err != nil {
+		return fmt.Errorf("DeployIflow: %w", err)
+	}
+	deadline := time.Now().Add(deployTimeout)
+	for {
+		artifact, err := client.GetRuntimeArtifact(ctx, iflow.ID)
+		if err != nil && !errors.Is(err, ErrArtifactNotFound) {
+			return fmt.Errorf("GetRuntimeArtifact: %w", err)
+		}
+		if previous.DeployedOn != "" && artifact.DeployedOn == previous.DeployedOn {
+			artifact.Status = ""
+		}
+		switch artifact.Status {
+		case RuntimeStatusStarted:
+			return nil
+		case RuntimeStatusError:
+			return fmt.Errorf("%w: %s runtime status is %s", ErrDeployFailed, iflow.ID, artifact.Status)
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("%w: %s not started after %s", ErrDeployTimeout, iflow.ID, deployTimeout)
+		}
+		select {
+		case <-time.After(deployPollInterval):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
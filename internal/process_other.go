@@ -0,0 +1,8 @@
+//go:build !unix && !windows
+
+package internal
+
+import "os/exec"
+
+// killProcessGroup keeps the default cancellation, only cmd itself is killed.
+func killProcessGroup(cmd *exec.Cmd) {}
@@ -2,10 +2,16 @@ package internal
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"io"
 	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 )
@@ -15,13 +21,13 @@ func TestUploadScripts(t *testing.T) {
 		mockedClient := BTPClientMock{
 			requestTokenError: ErrUnexpectedStatusCode,
 		}
-		require.ErrorIs(t, UploadScripts(&mockedClient, nil, nil), ErrUnexpectedStatusCode)
+		require.ErrorIs(t, UploadScripts(t.Context(), &mockedClient, nil, nil, UploadOptions{}), ErrUnexpectedStatusCode)
 	})
 	t.Run("FailingFetchCSRFToken", func(t *testing.T) {
 		mockedClient := BTPClientMock{
 			fetchCSRFTokenError: ErrUnexpectedStatusCode,
 		}
-		require.ErrorIs(t, UploadScripts(&mockedClient, nil, nil), ErrUnexpectedStatusCode)
+		require.ErrorIs(t, UploadScripts(t.Context(), &mockedClient, nil, nil, UploadOptions{}), ErrUnexpectedStatusCode)
 	})
 	t.Run("OneReadFileFailed", func(t *testing.T) {
 		header := http.Header{}
@@ -31,9 +37,9 @@ func TestUploadScripts(t *testing.T) {
 			{res: &http.Response{StatusCode: http.StatusOK, Header: header}},
 		})
 		client := NewBTPClient(mockedHTTPClient, ttokenURL, tapiURL, tclientID, tclientSecret)
-		err := UploadScripts(client, func(string) ([]byte, error) {
+		err := UploadScripts(t.Context(), client, func(string) ([]byte, error) {
 			return nil, fmt.Errorf("read failed")
-		}, []Iflow{{ID: "iflow1", Version: "iflowv1", Scripts: []Script{{ID: "script1", Type: "groovy", Path: "path1"}}}})
+		}, []Iflow{{ID: "iflow1", Version: "iflowv1", Scripts: []Script{{ID: "script1", Type: "groovy", Path: "path1"}}}}, UploadOptions{})
 		require.ErrorContains(t, err, "some reading/uploading")
 	})
 	t.Run("AllReadFileFailed", func(t *testing.T) {
@@ -44,62 +50,318 @@ func TestUploadScripts(t *testing.T) {
 			{res: &http.Response{StatusCode: http.StatusOK, Header: header}},
 		})
 		client := NewBTPClient(mockedHTTPClient, ttokenURL, tapiURL, tclientID, tclientSecret)
-		err := UploadScripts(client, func(string) ([]byte, error) {
+		err := UploadScripts(t.Context(), client, func(string) ([]byte, error) {
 			return nil, fmt.Errorf("read failed")
-		}, []Iflow{{ID: "iflow1", Version: "iflowv1", Scripts: []Script{{ID: "script1", Type: "groovy", Path: "path1"}, {ID: "script2", Type: "js", Path: "path2"}}}})
+		}, []Iflow{{ID: "iflow1", Version: "iflowv1", Scripts: []Script{{ID: "script1", Type: "groovy", Path: "path1"}, {ID: "script2", Type: "js", Path: "path2"}}}}, UploadOptions{})
 		require.ErrorContains(t, err, "some reading/uploading")
 	})
 	t.Run("PartReadFileFailed", func(t *testing.T) {
 		mockedClient := BTPClientMock{
 			updateIflowResourceErrors: []error{nil},
 		}
-		err := UploadScripts(&mockedClient, func(path string) ([]byte, error) {
+		err := UploadScripts(t.Context(), &mockedClient, func(path string) ([]byte, error) {
 			if path == "path1" {
 				return nil, fmt.Errorf("read failed")
 			}
 			return []byte(`data`), nil
-		}, []Iflow{{ID: "iflow1", Version: "iflowv1", Scripts: []Script{{ID: "script1", Type: "groovy", Path: "path1"}, {ID: "script2", Type: "js", Path: "path2"}}}})
+		}, []Iflow{{ID: "iflow1", Version: "iflowv1", Scripts: []Script{{ID: "script1", Type: "groovy", Path: "path1"}, {ID: "script2", Type: "js", Path: "path2"}}}}, UploadOptions{})
 		require.ErrorContains(t, err, "some reading/uploading")
 	})
 	t.Run("PartUpdateFailed", func(t *testing.T) {
 		mockedClient := BTPClientMock{
 			updateIflowResourceErrors: []error{ErrUnexpectedStatusCode, nil},
 		}
-		err := UploadScripts(&mockedClient, func(path string) ([]byte, error) {
+		err := UploadScripts(t.Context(), &mockedClient, func(path string) ([]byte, error) {
 			if path == "path1" {
 				return nil, fmt.Errorf("read failed")
 			}
 			return []byte(`data`), nil
-		}, []Iflow{{ID: "iflow1", Version: "iflowv1", Scripts: []Script{{ID: "script1", Type: "groovy", Path: "path2"}, {ID: "script2", Type: "js", Path: "path3"}}}})
+		}, []Iflow{{ID: "iflow1", Version: "iflowv1", Scripts: []Script{{ID: "script1", Type: "groovy", Path: "path2"}, {ID: "script2", Type: "js", Path: "path3"}}}}, UploadOptions{})
 		require.ErrorContains(t, err, "some reading/uploading")
 	})
 	t.Run("AllSucceed", func(t *testing.T) {
 		mockedClient := BTPClientMock{
 			updateIflowResourceErrors: []error{nil, nil},
 		}
-		err := UploadScripts(&mockedClient, func(path string) ([]byte, error) {
+		err := UploadScripts(t.Context(), &mockedClient, func(path string) ([]byte, error) {
 			if path == "path1" {
 				return nil, fmt.Errorf("read failed")
 			}
 			return []byte(`data`), nil
-		}, []Iflow{{ID: "iflow1", Version: "iflowv1", Scripts: []Script{{ID: "script1", Type: "groovy", Path: "path2"}, {ID: "script2", Type: "js", Path: "path3"}}}})
+		}, []Iflow{{ID: "iflow1", Version: "iflowv1", Scripts: []Script{{ID: "script1", Type: "groovy", Path: "path2"}, {ID: "script2", Type: "js", Path: "path3"}}}}, UploadOptions{})
 		require.Nil(t, err)
 	})
 }
 
+// noDeployPollInterval polls the runtime status of deployed iflows without waiting, until the test ends.
+func noDeployPollInterval(t *testing.T) {
+	interval := deployPollInterval
+	deployPollInterval = 0
+	t.Cleanup(func() { deployPollInterval = interval })
+}
+
+func TestUploadScriptsDeploy(t *testing.T) {
+	noDeployPollInterval(t)
+	readFile := func(path string) ([]byte, error) {
+		if path == "missing" {
+			return nil, fmt.Errorf("read failed")
+		}
+		return []byte(`data`), nil
+	}
+	t.Run("NotRequested", func(t *testing.T) {
+		mockedClient := BTPClientMock{updateIflowResourceErrors: []error{nil}}
+		err := UploadScripts(t.Context(), &mockedClient, readFile, []Iflow{{ID: "iflow1", Version: "active", Scripts: []Script{{ID: "script1", Path: "path1"}}}}, UploadOptions{})
+		require.NoError(t, err)
+		require.Empty(t, mockedClient.deployed)
+	})
+	t.Run("NothingUploaded", func(t *testing.T) {
+		mockedClient := BTPClientMock{}
+		err := UploadScripts(t.Context(), &mockedClient, readFile, []Iflow{{ID: "iflow1", Version: "active", Deploy: true, Scripts: []Script{{ID: "script1", Path: "missing"}}}}, UploadOptions{})
+		require.ErrorContains(t, err, "some reading/uploading")
+		require.Empty(t, mockedClient.deployed)
+	})
+	t.Run("DeployedFromConfig", func(t *testing.T) {
+		mockedClient := BTPClientMock{
+			updateIflowResourceErrors: []error{nil, nil},
+			runtimeArtifacts: []RuntimeArtifact{
+				{ID: "iflow1", Status: RuntimeStatusStarted, DeployedOn: "/Date(1)/"},
+				{ID: "iflow1", Status: RuntimeStatusStarted, DeployedOn: "/Date(1)/"},
+				{ID: "iflow1", Status: "STARTING", DeployedOn: "/Date(2)/"},
+				{ID: "iflow1", Status: RuntimeStatusStarted, DeployedOn: "/Date(2)/"},
+			},
+		}
+		err := UploadScripts(t.Context(), &mockedClient, readFile, []Iflow{
+			{ID: "iflow1", Version: "active", Deploy: true, Scripts: []Script{{ID: "script1", Path: "path1"}}},
+			{ID: "iflow2", Version: "active", Scripts: []Script{{ID: "script2", Path: "path2"}}},
+		}, UploadOptions{})
+		require.NoError(t, err)
+		require.Equal(t, []string{"iflow1"}, mockedClient.deployed)
+		require.Empty(t, mockedClient.runtimeArtifacts)
+	})
+	t.Run("DeployedFromOptions", func(t *testing.T) {
+		mockedClient := BTPClientMock{
+			updateIflowResourceErrors: []error{nil},
+			runtimeArtifacts: []RuntimeArtifact{
+				{},
+				{},
+				{ID: "iflow1", Status: RuntimeStatusStarted, DeployedOn: "/Date(2)/"},
+			},
+		}
+		err := UploadScripts(t.Context(), &mockedClient, readFile, []Iflow{{ID: "iflow1", Version: "active", Scripts: []Script{{ID: "script1", Path: "path1"}}}}, UploadOptions{Deploy: true})
+		require.NoError(t, err)
+		require.Equal(t, []string{"iflow1"}, mockedClient.deployed)
+	})
+	t.Run("RuntimeError", func(t *testing.T) {
+		mockedClient := BTPClientMock{
+			updateIflowResourceErrors: []error{nil},
+			runtimeArtifacts: []RuntimeArtifact{
+				{},
+				{ID: "iflow1", Status: RuntimeStatusError, DeployedOn: "/Date(2)/"},
+			},
+		}
+		err := UploadScripts(t.Context(), &mockedClient, readFile, []Iflow{{ID: "iflow1", Version: "active", Deploy: true, Scripts: []Script{{ID: "script1", Path: "path1"}}}}, UploadOptions{})
+		require.ErrorContains(t, err, "some deployments failed")
+	})
+	t.Run("DeployRequestFailed", func(t *testing.T) {
+		mockedClient := BTPClientMock{
+			updateIflowResourceErrors: []error{nil},
+			deployIflowError:          ErrUnexpectedStatusCode,
+			runtimeArtifacts:          []RuntimeArtifact{{}},
+		}
+		err := UploadScripts(t.Context(), &mockedClient, readFile, []Iflow{{ID: "iflow1", Version: "active", Deploy: true, Scripts: []Script{{ID: "script1", Path: "path1"}}}}, UploadOptions{})
+		require.ErrorContains(t, err, "some deployments failed")
+	})
+}
+
+func TestUploadScriptsOnlyChanged(t *testing.T) {
+	mockedClient := BTPClientMock{
+		updateIflowResourceErrors: []error{nil, nil},
+		resources:                 map[string][]byte{"script1": []byte(`data`), "script2": []byte(`old`)},
+	}
+	err := UploadScripts(t.Context(), &mockedClient, func(string) ([]byte, error) {
+		return []byte(`data`), nil
+	}, []Iflow{{ID: "iflow1", Version: "active", Scripts: []Script{{ID: "script1", Path: "path1"}, {ID: "script2", Path: "path2"}, {ID: "script3", Path: "path3"}}}}, UploadOptions{OnlyChanged: true})
+	require.NoError(t, err)
+	// script1 is unchanged, script2 and script3 are uploaded.
+	require.Empty(t, mockedClient.updateIflowResourceErrors)
+}
+
+// uploadRecorder delays the uploads of a script by its delay, recording the maximum number of uploads in flight.
+type uploadRecorder struct {
+	BTPClientMock
+	delays      map[string]time.Duration
+	mu          sync.Mutex
+	inFlight    int
+	maxInFlight int
+	uploaded    []string
+}
+
+func (c *uploadRecorder) UpdateIflowResource(ctx context.Context, data []byte, iflow Iflow, script Script) error {
+	c.mu.Lock()
+	c.inFlight++
+	c.maxInFlight = max(c.maxInFlight, c.inFlight)
+	c.mu.Unlock()
+	time.Sleep(c.delays[script.ID])
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.inFlight--
+	c.uploaded = append(c.uploaded, script.ID)
+	if script.ID == "script2" {
+		return ErrUnexpectedStatusCode
+	}
+	return nil
+}
+
+func TestRunUploadJobs(t *testing.T) {
+	iflows := []Iflow{{ID: "iflow1", Version: "active"}, {ID: "iflow2", Version: "active"}}
+	client := &uploadRecorder{delays: map[string]time.Duration{
+		"script1": 40 * time.Millisecond,
+		"script2": 30 * time.Millisecond,
+		"script3": 20 * time.Millisecond,
+		"script4": 10 * time.Millisecond,
+	}}
+	jobs := []uploadJob{
+		{iflow: 0, script: Script{ID: "script1", Type: "groovy", Path: "path1"}},
+		{iflow: 0, script: Script{ID: "script2", Type: "groovy", Path: "path2"}},
+		{iflow: 1, script: Script{ID: "script3", Type: "groovy", Path: "path3"}},
+		{iflow: 1, script: Script{ID: "script4", Type: "groovy", Path: "path4"}},
+		{iflow: 1, script: Script{ID: "script5", Type: "groovy", Path: "missing"}},
+	}
+	runUploadJobs(t.Context(), client, func(path string) ([]byte, error) {
+		if path == "missing" {
+			return nil, fmt.Errorf("read failed")
+		}
+		return []byte(`data`), nil
+	}, iflows, jobs, UploadOptions{Concurrency: 2})
+
+	require.LessOrEqual(t, client.maxInFlight, 2)
+	require.ElementsMatch(t, []string{"script1", "script2", "script3", "script4"}, client.uploaded)
+	var output []string
+	for _, job := range jobs {
+		output = append(output, job.output.String())
+	}
+	require.Equal(t, []string{
+		"SUCCESS uploading script1\n",
+		"FAILURE uploading script2, unexpected status code\n",
+		"SUCCESS uploading script3\n",
+		"SUCCESS uploading script4\n",
+		"FAILURE reading missing, read failed\n",
+	}, output)
+	require.Equal(t, []bool{true, false, true, true, false}, []bool{jobs[0].uploaded, jobs[1].uploaded, jobs[2].uploaded, jobs[3].uploaded, jobs[4].uploaded})
+	require.True(t, jobs[1].failed)
+	require.True(t, jobs[4].failed)
+}
+
+func TestUploadScriptsCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(t.Context())
+	mockedClient := BTPClientMock{
+		updateIflowResourceErrors: []error{nil},
+	}
+	err := UploadScripts(ctx, &mockedClient, func(string) ([]byte, error) {
+		cancel()
+		return []byte(`data`), nil
+	}, []Iflow{{ID: "iflow1", Version: "active", Deploy: true, Scripts: []Script{{ID: "script1", Path: "path1"}}}}, UploadOptions{Prune: true})
+	require.ErrorIs(t, err, context.Canceled)
+	require.Empty(t, mockedClient.deployed)
+}
+
+// fakeGroovy puts a groovy shell script running script first in PATH.
+func fakeGroovy(t *testing.T, script string) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake groovy is a shell script")
+	}
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "groovy"), []byte("#!/bin/sh\n"+script), 0o755))
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	t.Setenv("GROOVY_HOME", "")
+	cache := t.TempDir()
+	stubsCacheDir = func() (string, error) { return cache, nil }
+	t.Cleanup(func() { stubsCacheDir = os.UserCacheDir })
+}
+
+func TestExecuteTests(t *testing.T) {
+	t.Run("Passing", func(t *testing.T) {
+		fakeGroovy(t, "echo \"running $3\"\n")
+		var stdout bytes.Buffer
+		results, err := ExecuteTests(t.Context(), []string{"a.groovy", "b.groovy"}, nil, &stdout, io.Discard, TestOptions{})
+		require.NoError(t, err)
+		require.True(t, TestsPassed(results))
+		require.Len(t, results, 2)
+		require.Equal(t, "running a.groovy\n", results[0].Stdout)
+		require.Zero(t, results[0].ExitCode)
+		require.Equal(t, "Running tests:  a.groovy\nrunning a.groovy\nRunning tests:  b.groovy\nrunning b.groovy\n", stdout.String())
+	})
+
+	t.Run("Failing", func(t *testing.T) {
+		fakeGroovy(t, "echo oops >&2\n[ \"$3\" = a.groovy ] || exit 3\n")
+		results, err := ExecuteTests(t.Context(), []string{"a.groovy", "b.groovy"}, nil, io.Discard, io.Discard, TestOptions{})
+		require.NoError(t, err)
+		require.False(t, TestsPassed(results))
+		require.NoError(t, results[0].Err)
+		require.Error(t, results[1].Err)
+		require.NotErrorIs(t, results[1].Err, ErrTestTimeout)
+		require.Equal(t, 3, results[1].ExitCode)
+		require.Equal(t, "oops\n", results[1].Stderr)
+	})
+
+	t.Run("Parallel", func(t *testing.T) {
+		fakeGroovy(t, "echo \"$3 start\"\nsleep 0.5\necho \"$3 error\" >&2\n[ \"$3\" != b.groovy ]\n")
+		var stdout, stderr bytes.Buffer
+		start := time.Now()
+		results, err := ExecuteTests(t.Context(), []string{"a.groovy", "b.groovy", "c.groovy"}, nil, &stdout, &stderr, TestOptions{Parallel: 3})
+		require.NoError(t, err)
+		require.Less(t, time.Since(start), 1400*time.Millisecond)
+		require.False(t, TestsPassed(results))
+		require.Equal(t, []string{"a.groovy", "b.groovy", "c.groovy"}, []string{results[0].Path, results[1].Path, results[2].Path})
+		require.Error(t, results[1].Err)
+		for _, path := range []string{"a.groovy", "c.groovy"} {
+			require.Contains(t, stdout.String(), "Running tests:  "+path+"\n"+path+" start\n")
+			require.Contains(t, stderr.String(), path+" error\n")
+		}
+		require.Contains(t, stdout.String(), "Running tests:  b.groovy\nb.groovy start\nError tests: b.groovy\nexit status 1\n")
+		require.NotContains(t, stdout.String(), "error\n")
+	})
+
+	t.Run("Timeout", func(t *testing.T) {
+		marker := filepath.Join(t.TempDir(), "marker")
+		t.Setenv("MARKER", marker)
+		// the child process would outlive groovy if only groovy was killed.
+		fakeGroovy(t, "(sleep 1; touch \"$MARKER\") &\nwait\n")
+		start := time.Now()
+		result := executeTest(t.Context(), groovyCommand{binary: "groovy"}, testTarget{path: "a.groovy"}, io.Discard, io.Discard, 100*time.Millisecond)
+		require.ErrorIs(t, result.Err, ErrTestTimeout)
+		require.Equal(t, -1, result.ExitCode)
+		require.Less(t, time.Since(start), time.Second)
+		time.Sleep(1500 * time.Millisecond)
+		require.NoFileExists(t, marker)
+	})
+}
+
 type BTPClientMock struct {
+	mu                        sync.Mutex
 	requestTokenError         error
 	fetchCSRFTokenError       error
 	updateIflowResourceErrors []error
+	deployIflowError          error
+	runtimeArtifacts          []RuntimeArtifact
+	runtimeErrors             map[string]string
+	resources                 map[string][]byte
+	listedResources           []Resource
+	deleted                   []Resource
+	artifactNames             []string
+	artifact                  []byte
+	deployed                  []string
 }
 
-func (c *BTPClientMock) RequestToken() error {
+func (c *BTPClientMock) RequestToken(ctx context.Context) error {
 	return c.requestTokenError
 }
-func (c *BTPClientMock) FetchCSRFToken() error {
+func (c *BTPClientMock) FetchCSRFToken(ctx context.Context) error {
 	return c.fetchCSRFTokenError
 }
-func (c *BTPClientMock) UpdateIflowResource(data []byte, iflow Iflow, script Script) error {
+func (c *BTPClientMock) UpdateIflowResource(ctx context.Context, data []byte, iflow Iflow, script Script) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	if len(c.updateIflowResourceErrors) == 0 {
 		panic("")
 	}
@@ -107,3 +369,49 @@ func (c *BTPClientMock) UpdateIflowResource(data []byte, iflow Iflow, script Scr
 	c.updateIflowResourceErrors = c.updateIflowResourceErrors[1:]
 	return err
 }
+func (c *BTPClientMock) DeployIflow(ctx context.Context, iflow Iflow) error {
+	c.deployed = append(c.deployed, iflow.ID)
+	return c.deployIflowError
+}
+func (c *BTPClientMock) GetRuntimeArtifact(ctx context.Context, id string) (RuntimeArtifact, error) {
+	if len(c.runtimeArtifacts) == 0 {
+		panic("")
+	}
+	artifact := c.runtimeArtifacts[0]
+	c.runtimeArtifacts = c.runtimeArtifacts[1:]
+	if artifact.ID == "" {
+		return artifact, ErrArtifactNotFound
+	}
+	return artifact, nil
+}
+func (c *BTPClientMock) GetRuntimeArtifactError(ctx context.Context, id string) (string, error) {
+	errorInformation, ok := c.runtimeErrors[id]
+	if !ok {
+		return "", ErrArtifactNotFound
+	}
+	return errorInformation, nil
+}
+func (c *BTPClientMock) GetIflowResource(ctx context.Context, iflow Iflow, script Script) ([]byte, error) {
+	data, ok := c.resources[script.ID]
+	if !ok {
+		return nil, ErrResourceNotFound
+	}
+	return data, nil
+}
+func (c *BTPClientMock) ListIflowResources(ctx context.Context, iflow Iflow) ([]Resource, error) {
+	return c.listedResources, nil
+}
+func (c *BTPClientMock) DeleteIflowResource(ctx context.Context, iflow Iflow, resource Resource) error {
+	c.deleted = append(c.deleted, resource)
+	return nil
+}
+func (c *BTPClientMock) UpdateIflowArtifact(ctx context.Context, name string, content []byte, iflow Iflow) error {
+	c.artifactNames = append(c.artifactNames, name)
+	return nil
+}
+func (c *BTPClientMock) DownloadIflowArtifact(ctx context.Context, iflow Iflow) ([]byte, error) {
+	if c.artifact == nil {
+		return nil, ErrArtifactNotFound
+	}
+	return c.artifact, nil
+}
@@ -0,0 +1,14 @@
+package internal
+
+import (
+	"os/exec"
+	"strconv"
+)
+
+// killProcessGroup kills the whole process tree of cmd when it is canceled,
+// groovy being a batch file starting java.
+func killProcessGroup(cmd *exec.Cmd) {
+	cmd.Cancel = func() error {
+		return exec.Command("taskkill", "/T", "/F", "/PID", strconv.Itoa(cmd.Process.Pid)).Run()
+	}
+}
@@ -0,0 +1,70 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+)
+
+// IflowResource is a resource of a given iflow.
+type IflowResource struct {
+	Iflow    Iflow
+	Resource Resource
+}
+
+func (r IflowResource) String() string {
+	return fmt.Sprintf("%s: %s (%s)", r.Iflow.ID, r.Resource.Name, r.Resource.ResourceType)
+}
+
+// pruneResources deletes the iflows resources not referenced by the manifest once confirmed.
+// It returns the number of deleted resources of each iflow.
+func pruneResources(ctx context.Context, client IBTPClient, iflows []Iflow, confirm func([]IflowResource) (bool, error)) ([]int, error) {
+	deleted := make([]int, len(iflows))
+	var pruneErr error
+	var unreferenced []IflowResource
+	for _, iflow := range iflows {
+		resources, err := unreferencedResources(ctx, client, iflow)
+		if err != nil {
+			fmt.Printf("FAILURE listing %s resources, %v\n", iflow.ID, err)
+			pruneErr = fmt.Errorf("some listing/deleting resources failed")
+			continue
+		}
+		for _, resource := range resources {
+			unreferenced = append(unreferenced, IflowResource{Iflow: iflow, Resource: resource})
+		}
+	}
+	if len(unreferenced) == 0 {
+		fmt.Println("Nothing to prune")
+		return deleted, pruneErr
+	}
+
+	fmt.Println("Resources to prune:")
+	for _, resource := range unreferenced {
+		fmt.Printf("  %s\n", resource)
+	}
+	if confirm != nil {
+		confirmed, err := confirm(unreferenced)
+		if err != nil {
+			fmt.Printf("FAILURE confirming prune, %v\n", err)
+			return deleted, fmt.Errorf("confirming prune: %w", err)
+		}
+		if !confirmed {
+			fmt.Println("Prune cancelled")
+			return deleted, pruneErr
+		}
+	}
+
+	for _, resource := range unreferenced {
+		if err := client.DeleteIflowResource(ctx, resource.Iflow, resource.Resource); err != nil {
+			fmt.Printf("FAILURE deleting %s, %v\n", resource, err)
+			pruneErr = fmt.Errorf("some listing/deleting resources failed")
+			continue
+		}
+		fmt.Printf("SUCCESS deleting %s\n", resource)
+		for i, iflow := range iflows {
+			if iflow.ID == resource.Iflow.ID && iflow.Version == resource.Iflow.Version {
+				deleted[i]++
+			}
+		}
+	}
+	return deleted, pruneErr
+}
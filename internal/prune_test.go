@@ -0,0 +1,65 @@
+package internal
+
+import (
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestUploadScriptsPrune(t *testing.T) {
+	noDeployPollInterval(t)
+	readFile := func(string) ([]byte, error) {
+		return []byte(`data`), nil
+	}
+	iflows := []Iflow{{ID: "iflow1", Version: "active", Scripts: []Script{{ID: "script1.groovy", Type: "groovy", Path: "path1"}}}}
+	newClient := func() *BTPClientMock {
+		return &BTPClientMock{
+			updateIflowResourceErrors: []error{nil},
+			listedResources: []Resource{
+				{Name: "script1.groovy", ResourceType: "groovy"},
+				{Name: "old.groovy", ResourceType: "groovy"},
+				{Name: "mapping.xsl", ResourceType: "xslt"},
+			},
+		}
+	}
+	t.Run("NotRequested", func(t *testing.T) {
+		mockedClient := newClient()
+		require.NoError(t, UploadScripts(t.Context(), mockedClient, readFile, iflows, UploadOptions{}))
+		require.Empty(t, mockedClient.deleted)
+	})
+	t.Run("Confirmed", func(t *testing.T) {
+		mockedClient := newClient()
+		var confirmed []IflowResource
+		require.NoError(t, UploadScripts(t.Context(), mockedClient, readFile, iflows, UploadOptions{Prune: true, ConfirmPrune: func(resources []IflowResource) (bool, error) {
+			confirmed = resources
+			return true, nil
+		}}))
+		require.Equal(t, []IflowResource{{Iflow: iflows[0], Resource: Resource{Name: "old.groovy", ResourceType: "groovy"}}}, confirmed)
+		require.Equal(t, "iflow1: old.groovy (groovy)", confirmed[0].String())
+		require.Equal(t, []Resource{{Name: "old.groovy", ResourceType: "groovy"}}, mockedClient.deleted)
+	})
+	t.Run("Cancelled", func(t *testing.T) {
+		mockedClient := newClient()
+		require.NoError(t, UploadScripts(t.Context(), mockedClient, readFile, iflows, UploadOptions{Prune: true, ConfirmPrune: func([]IflowResource) (bool, error) {
+			return false, nil
+		}}))
+		require.Empty(t, mockedClient.deleted)
+	})
+	t.Run("ConfirmationFailed", func(t *testing.T) {
+		mockedClient := newClient()
+		err := UploadScripts(t.Context(), mockedClient, readFile, iflows, UploadOptions{Prune: true, ConfirmPrune: func([]IflowResource) (bool, error) {
+			return false, io.EOF
+		}})
+		require.ErrorIs(t, err, io.EOF)
+		require.Empty(t, mockedClient.deleted)
+	})
+	t.Run("DeployAfterPruneOnly", func(t *testing.T) {
+		mockedClient := newClient()
+		mockedClient.resources = map[string][]byte{"script1.groovy": []byte(`data`)}
+		mockedClient.updateIflowResourceErrors = nil
+		mockedClient.runtimeArtifacts = []RuntimeArtifact{{}, {ID: "iflow1", Status: RuntimeStatusStarted}}
+		require.NoError(t, UploadScripts(t.Context(), mockedClient, readFile, iflows, UploadOptions{OnlyChanged: true, Prune: true, Deploy: true}))
+		require.Equal(t, []string{"iflow1"}, mockedClient.deployed)
+	})
+}
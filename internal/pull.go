@@ -0,0 +1,71 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+)
+
+var ErrDrift = errors.New("tenant scripts differ from local files")
+
+// PullOptions tunes PullScripts behaviour.
+type PullOptions struct {
+	// DryRun reports the files that would be written without writing them.
+	DryRun bool
+	// Check reports drifting files without writing them, PullScripts then fails with ErrDrift.
+	Check bool
+}
+
+// PullScripts authenticates over oauth2, then writes tenant scripts content to their local path.
+func PullScripts(ctx context.Context, client IBTPClient, readFile func(string) ([]byte, error), writeFile func(string, []byte) error, iflows []Iflow, opts PullOptions) error {
+	if err := client.RequestToken(ctx); err != nil {
+		return fmt.Errorf("RequestToken: %w", err)
+	}
+
+	var pullErr error
+	drift := false
+	for _, iflow := range iflows {
+		for _, script := range iflow.Scripts {
+			remote, err := client.GetIflowResource(ctx, iflow, script)
+			if err != nil {
+				fmt.Printf("FAILURE downloading %s, %v\n", script.ID, err)
+				pullErr = fmt.Errorf("some downloading/writing scripts failed")
+				continue
+			}
+			// a missing local file is reported as drifting.
+			local, err := readFile(script.Path)
+			if err != nil && !errors.Is(err, fs.ErrNotExist) {
+				fmt.Printf("FAILURE reading %s, %v\n", script.Path, err)
+				pullErr = fmt.Errorf("some downloading/writing scripts failed")
+				continue
+			}
+			if err == nil && bytes.Equal(local, remote) {
+				fmt.Printf("UNCHANGED %s\n", script.Path)
+				continue
+			}
+			switch {
+			case opts.Check:
+				fmt.Printf("DRIFT %s\n", script.Path)
+				drift = true
+			case opts.DryRun:
+				fmt.Printf("WOULD UPDATE %s\n", script.Path)
+			default:
+				if err := writeFile(script.Path, remote); err != nil {
+					fmt.Printf("FAILURE writing %s, %v\n", script.Path, err)
+					pullErr = fmt.Errorf("some downloading/writing scripts failed")
+					continue
+				}
+				fmt.Printf("UPDATED %s\n", script.Path)
+			}
+		}
+	}
+	if pullErr != nil {
+		return pullErr
+	}
+	if drift {
+		return ErrDrift
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+package internal
+
+import (
+	"fmt"
+	"io/fs"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPullScripts(t *testing.T) {
+	iflows := []Iflow{{ID: "iflow1", Version: "active", Scripts: []Script{
+		{ID: "script1", Type: "groovy", Path: "path1"},
+		{ID: "script2", Type: "groovy", Path: "path2"},
+	}}}
+	newClient := func() *BTPClientMock {
+		return &BTPClientMock{resources: map[string][]byte{"script1": []byte(`same`), "script2": []byte(`remote`)}}
+	}
+	readFile := func(path string) ([]byte, error) {
+		if path == "path1" {
+			return []byte(`same`), nil
+		}
+		return []byte(`local`), nil
+	}
+	t.Run("FailingRequestToken", func(t *testing.T) {
+		mockedClient := BTPClientMock{requestTokenError: ErrUnexpectedStatusCode}
+		require.ErrorIs(t, PullScripts(t.Context(), &mockedClient, nil, nil, nil, PullOptions{}), ErrUnexpectedStatusCode)
+	})
+	t.Run("WritesChanged", func(t *testing.T) {
+		written := map[string][]byte{}
+		err := PullScripts(t.Context(), newClient(), readFile, func(path string, data []byte) error {
+			written[path] = data
+			return nil
+		}, iflows, PullOptions{})
+		require.NoError(t, err)
+		require.Equal(t, map[string][]byte{"path2": []byte(`remote`)}, written)
+	})
+	t.Run("WritesMissingLocal", func(t *testing.T) {
+		written := map[string][]byte{}
+		err := PullScripts(t.Context(), newClient(), func(path string) ([]byte, error) {
+			return nil, &fs.PathError{Op: "open", Path: path, Err: fs.ErrNotExist}
+		}, func(path string, data []byte) error {
+			written[path] = data
+			return nil
+		}, iflows, PullOptions{})
+		require.NoError(t, err)
+		require.Len(t, written, 2)
+	})
+	t.Run("ReadFailed", func(t *testing.T) {
+		readFailed := func(string) ([]byte, error) {
+			return nil, fs.ErrPermission
+		}
+		err := PullScripts(t.Context(), newClient(), readFailed, func(string, []byte) error {
+			panic("unexpected write")
+		}, iflows, PullOptions{})
+		require.ErrorContains(t, err, "some downloading/writing")
+
+		err = PullScripts(t.Context(), newClient(), readFailed, nil, iflows, PullOptions{Check: true})
+		require.NotErrorIs(t, err, ErrDrift)
+		require.ErrorContains(t, err, "some downloading/writing")
+	})
+	t.Run("DryRun", func(t *testing.T) {
+		err := PullScripts(t.Context(), newClient(), readFile, func(string, []byte) error {
+			panic("unexpected write")
+		}, iflows, PullOptions{DryRun: true})
+		require.NoError(t, err)
+	})
+	t.Run("CheckDrift", func(t *testing.T) {
+		err := PullScripts(t.Context(), newClient(), readFile, func(string, []byte) error {
+			panic("unexpected write")
+		}, iflows, PullOptions{Check: true})
+		require.ErrorIs(t, err, ErrDrift)
+	})
+	t.Run("CheckNoDrift", func(t *testing.T) {
+		err := PullScripts(t.Context(), newClient(), func(string) ([]byte, error) {
+			return []byte(`same`), nil
+		}, nil, []Iflow{{ID: "iflow1", Scripts: []Script{{ID: "script1", Path: "path1"}}}}, PullOptions{Check: true})
+		require.NoError(t, err)
+	})
+	t.Run("DownloadFailed", func(t *testing.T) {
+		mockedClient := BTPClientMock{}
+		err := PullScripts(t.Context(), &mockedClient, readFile, nil, iflows, PullOptions{})
+		require.ErrorContains(t, err, "some downloading/writing")
+	})
+	t.Run("WriteFailed", func(t *testing.T) {
+		err := PullScripts(t.Context(), newClient(), readFile, func(string, []byte) error {
+			return fmt.Errorf("write failed")
+		}, iflows, PullOptions{})
+		require.ErrorContains(t, err, "some downloading/writing")
+	})
+}
@@ -0,0 +1,231 @@
+package internal
+
+import (
+	"bufio"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+)
+
+// TestCase is a test reported by the output of a test script.
+type TestCase struct {
+	Name      string
+	ClassName string
+	// Failure is the failure message, empty when the test passed.
+	Failure string
+	// Details are the lines following the failure message, such as the stack trace.
+	Details string
+	// Error tells the failure is an unexpected error rather than a failed assertion.
+	Error   bool
+	Skipped bool
+}
+
+var (
+	// junitFailuresRegexp starts the failures section of the JUnit text runners.
+	junitFailuresRegexp = regexp.MustCompile(`^There (?:was 1|were \d+) (failure|error)s?:$`)
+	// junitFailureRegexp is a failed test of the JUnit text runners: `1) testName(ClassName)message`.
+	junitFailureRegexp = regexp.MustCompile(`^\d+\) ([^()\s]+)\(([^()]+)\)(.*)$`)
+	// treeNodeRegexp is a test of the JUnit platform (Spock, Jupiter) tree output: `│  ├─ name ✔`.
+	treeNodeRegexp = regexp.MustCompile(`^([│├└─ ]*[├└]─ )(.+?) ([✔✘↷■])(?: (.*))?$`)
+)
+
+// parseTestCases extracts the test cases from the output of JUnit 3/4 text runners,
+// which only name the failed tests, and of the JUnit platform tree, used by Spock.
+func parseTestCases(output string) []TestCase {
+	return append(parseJUnitFailures(output), parseTestTree(output)...)
+}
+
+func parseJUnitFailures(output string) []TestCase {
+	var cases []TestCase
+	inFailures, isError := false, false
+	current := -1
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if match := junitFailuresRegexp.FindStringSubmatch(line); match != nil {
+			inFailures, isError, current = true, match[1] == "error", -1
+			continue
+		}
+		if !inFailures {
+			continue
+		}
+		if line == "FAILURES!!!" || strings.HasPrefix(line, "Tests run:") {
+			inFailures, current = false, -1
+			continue
+		}
+		if match := junitFailureRegexp.FindStringSubmatch(line); match != nil {
+			cases = append(cases, TestCase{Name: match[1], ClassName: match[2], Failure: strings.TrimSpace(match[3]), Error: isError})
+			current = len(cases) - 1
+			continue
+		}
+		if current < 0 {
+			continue
+		}
+		// JUnit 4 prints the failure message on the line following the test name.
+		if cases[current].Failure == "" {
+			cases[current].Failure = strings.TrimSpace(line)
+			continue
+		}
+		cases[current].Details += line + "\n"
+	}
+	return cases
+}
+
+// testNode is a line of the JUnit platform tree.
+type testNode struct {
+	depth   int
+	name    string
+	status  string
+	message string
+}
+
+func parseTestTree(output string) []TestCase {
+	var nodes []testNode
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		match := treeNodeRegexp.FindStringSubmatch(strings.TrimRight(scanner.Text(), "\r"))
+		if match == nil {
+			continue
+		}
+		nodes = append(nodes, testNode{depth: len([]rune(match[1])) / 3, name: match[2], status: match[3], message: match[4]})
+	}
+
+	var cases []TestCase
+	for i, node := range nodes {
+		// containers (engines, classes) have deeper nodes following them.
+		if i+1 < len(nodes) && nodes[i+1].depth > node.depth {
+			continue
+		}
+		className := ""
+		for j := i - 1; j >= 0; j-- {
+			if nodes[j].depth < node.depth {
+				className = nodes[j].name
+				break
+			}
+		}
+		// a leaf without parent is an engine without tests.
+		if className == "" {
+			continue
+		}
+		testCase := TestCase{Name: node.name, ClassName: className}
+		switch node.status {
+		case "✘":
+			testCase.Failure = node.message
+			if testCase.Failure == "" {
+				testCase.Failure = "failed"
+			}
+		case "↷", "■":
+			testCase.Skipped = true
+		}
+		cases = append(cases, testCase)
+	}
+	return cases
+}
+
+// junitTestSuites is the root of a JUnit XML report.
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Errors   int              `xml:"errors,attr"`
+	Time     string           `xml:"time,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name     string          `xml:"name,attr"`
+	Tests    int             `xml:"tests,attr"`
+	Failures int             `xml:"failures,attr"`
+	Errors   int             `xml:"errors,attr"`
+	Skipped  int             `xml:"skipped,attr"`
+	Time     string          `xml:"time,attr"`
+	Cases    []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr,omitempty"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	Error     *junitFailure `xml:"error,omitempty"`
+	Skipped   *struct{}     `xml:"skipped,omitempty"`
+	SystemOut string        `xml:"system-out,omitempty"`
+	SystemErr string        `xml:"system-err,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// WriteJUnitReport writes the results as a JUnit XML report, with one test suite per test script.
+// Each suite has a test case for the test script itself, followed by the test cases parsed from its output.
+func WriteJUnitReport(results []TestResult, w io.Writer) error {
+	report := junitTestSuites{}
+	var total float64
+	for _, result := range results {
+		suite := junitTestSuite{Name: result.Path, Time: formatSeconds(result.Duration.Seconds())}
+		script := junitTestCase{
+			Name:      result.Path,
+			ClassName: "inco.test",
+			Time:      suite.Time,
+			SystemOut: result.Stdout,
+			SystemErr: result.Stderr,
+		}
+		switch {
+		case errors.Is(result.Err, ErrTestTimeout):
+			script.Error = &junitFailure{Message: result.Err.Error(), Type: "timeout"}
+		case result.Err != nil:
+			script.Failure = &junitFailure{Message: result.Err.Error(), Type: fmt.Sprintf("exit code %d", result.ExitCode)}
+		}
+		suite.Cases = append(suite.Cases, script)
+		for _, testCase := range result.Cases {
+			junitCase := junitTestCase{Name: testCase.Name, ClassName: testCase.ClassName}
+			switch {
+			case testCase.Skipped:
+				junitCase.Skipped = &struct{}{}
+			case testCase.Failure != "" && testCase.Error:
+				junitCase.Error = &junitFailure{Message: testCase.Failure, Type: "error", Text: testCase.Details}
+			case testCase.Failure != "":
+				junitCase.Failure = &junitFailure{Message: testCase.Failure, Type: "failure", Text: testCase.Details}
+			}
+			suite.Cases = append(suite.Cases, junitCase)
+		}
+		for _, testCase := range suite.Cases {
+			switch {
+			case testCase.Failure != nil:
+				suite.Failures++
+			case testCase.Error != nil:
+				suite.Errors++
+			case testCase.Skipped != nil:
+				suite.Skipped++
+			}
+		}
+		suite.Tests = len(suite.Cases)
+		report.Tests += suite.Tests
+		report.Failures += suite.Failures
+		report.Errors += suite.Errors
+		total += result.Duration.Seconds()
+		report.Suites = append(report.Suites, suite)
+	}
+	report.Time = formatSeconds(total)
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(report); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+func formatSeconds(seconds float64) string {
+	return fmt.Sprintf("%.3f", seconds)
+}
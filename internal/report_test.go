@@ -0,0 +1,111 @@
+package internal
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseTestCases(t *testing.T) {
+	t.Run("JUnit3", func(t *testing.T) {
+		output := `.F.E
+Time: 0.012
+There was 1 failure:
+1) testAdd(CalculatorTest)junit.framework.AssertionFailedError: expected:<3> but was:<4>
+	at CalculatorTest.testAdd(CalculatorTest.groovy:8)
+There was 1 error:
+1) testDivide(CalculatorTest)java.lang.ArithmeticException: Division by zero
+	at CalculatorTest.testDivide(CalculatorTest.groovy:12)
+
+FAILURES!!!
+Tests run: 3,  Failures: 1,  Errors: 1
+`
+		require.Equal(t, []TestCase{
+			{Name: "testAdd", ClassName: "CalculatorTest", Failure: "junit.framework.AssertionFailedError: expected:<3> but was:<4>", Details: "\tat CalculatorTest.testAdd(CalculatorTest.groovy:8)\n"},
+			{Name: "testDivide", ClassName: "CalculatorTest", Failure: "java.lang.ArithmeticException: Division by zero", Details: "\tat CalculatorTest.testDivide(CalculatorTest.groovy:12)\n\n", Error: true},
+		}, parseTestCases(output))
+	})
+
+	t.Run("JUnit4", func(t *testing.T) {
+		output := `JUnit version 4.13.2
+..E
+Time: 0.02
+There were 2 failures:
+1) testAdd(CalculatorTest)
+java.lang.AssertionError: expected:<3> but was:<4>
+2) testSub(CalculatorTest)
+java.lang.AssertionError: negative
+FAILURES!!!
+Tests run: 3,  Failures: 2
+`
+		require.Equal(t, []TestCase{
+			{Name: "testAdd", ClassName: "CalculatorTest", Failure: "java.lang.AssertionError: expected:<3> but was:<4>"},
+			{Name: "testSub", ClassName: "CalculatorTest", Failure: "java.lang.AssertionError: negative"},
+		}, parseTestCases(output))
+	})
+
+	t.Run("Tree", func(t *testing.T) {
+		output := `╷
+├─ JUnit Jupiter ✔
+├─ Spock ✔
+│  └─ CalculatorSpec ✔
+│     ├─ adds two numbers ✔
+│     ├─ divides ✘ Condition not satisfied:
+│     └─ rounds ↷ not implemented
+└─ JUnit Vintage ✔
+`
+		require.Equal(t, []TestCase{
+			{Name: "adds two numbers", ClassName: "CalculatorSpec"},
+			{Name: "divides", ClassName: "CalculatorSpec", Failure: "Condition not satisfied:"},
+			{Name: "rounds", ClassName: "CalculatorSpec", Skipped: true},
+		}, parseTestCases(output))
+	})
+
+	t.Run("PlainOutput", func(t *testing.T) {
+		require.Empty(t, parseTestCases("all good\n"))
+	})
+}
+
+func TestWriteJUnitReport(t *testing.T) {
+	var report bytes.Buffer
+	require.NoError(t, WriteJUnitReport([]TestResult{
+		{Path: "a.groovy", Duration: 1500 * time.Millisecond, Stdout: "ok <done>\n", Cases: []TestCase{
+			{Name: "adds", ClassName: "CalculatorSpec"},
+			{Name: "rounds", ClassName: "CalculatorSpec", Skipped: true},
+		}},
+		{Path: "b.groovy", Duration: time.Second, Stderr: "boom\n", ExitCode: 1, Err: errors.New("exit status 1"), Cases: []TestCase{
+			{Name: "testAdd", ClassName: "CalculatorTest", Failure: "expected:<3> but was:<4>", Details: "\tat line 8\n"},
+		}},
+		{Path: "c.groovy", Duration: 2 * time.Second, ExitCode: -1, Err: ErrTestTimeout},
+	}, &report))
+	require.Equal(t, `<?xml version="1.0" encoding="UTF-8"?>
+<testsuites tests="6" failures="2" errors="1" time="4.500">
+  <testsuite name="a.groovy" tests="3" failures="0" errors="0" skipped="1" time="1.500">
+    <testcase name="a.groovy" classname="inco.test" time="1.500">
+      <system-out>ok &lt;done&gt;&#xA;</system-out>
+    </testcase>
+    <testcase name="adds" classname="CalculatorSpec"></testcase>
+    <testcase name="rounds" classname="CalculatorSpec">
+      <skipped></skipped>
+    </testcase>
+  </testsuite>
+  <testsuite name="b.groovy" tests="2" failures="2" errors="0" skipped="0" time="1.000">
+    <testcase name="b.groovy" classname="inco.test" time="1.000">
+      <failure message="exit status 1" type="exit code 1"></failure>
+      <system-err>boom&#xA;</system-err>
+    </testcase>
+    <testcase name="testAdd" classname="CalculatorTest">
+      <failure message="expected:&lt;3&gt; but was:&lt;4&gt;" type="failure">&#x9;at line 8&#xA;</failure>
+    </testcase>
+  </testsuite>
+  <testsuite name="c.groovy" tests="1" failures="0" errors="1" skipped="0" time="2.000">
+    <testcase name="c.groovy" classname="inco.test" time="2.000">
+      <error message="test timeout" type="timeout"></error>
+    </testcase>
+  </testsuite>
+</testsuites>
+`, report.String())
+}
@@ -0,0 +1,49 @@
+package internal
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+)
+
+var ErrInvalidResource = errors.New("invalid resource")
+
+// CheckResource runs the local checks of the script type on the script content.
+func CheckResource(script Script, data []byte) error {
+	switch script.Type {
+	case ResourceTypeXSLT, ResourceTypeXSD, ResourceTypeWSDL, ResourceTypeEDMX, ResourceTypeMessageMapping, ResourceTypeOperationMapping:
+		if err := checkWellFormedXML(data); err != nil {
+			return fmt.Errorf("%w: %s is not well-formed XML: %v", ErrInvalidResource, script.Path, err)
+		}
+	case ResourceTypeJAR:
+		if _, err := zip.NewReader(bytes.NewReader(data), int64(len(data))); err != nil {
+			return fmt.Errorf("%w: %s is not a JAR archive: %v", ErrInvalidResource, script.Path, err)
+		}
+	}
+	return nil
+}
+
+// checkWellFormedXML reads every XML token, it fails on the first syntax error.
+func checkWellFormedXML(data []byte) error {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	root := false
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if _, ok := token.(xml.StartElement); ok {
+			root = true
+		}
+	}
+	if !root {
+		return errors.New("no root element")
+	}
+	return nil
+}
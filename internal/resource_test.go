@@ -0,0 +1,25 @@
+package internal
+
+import (
+	"archive/zip"
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckResource(t *testing.T) {
+	require.NoError(t, CheckResource(Script{Type: ResourceTypeGroovy}, []byte(`def x = <`)))
+	require.NoError(t, CheckResource(Script{Type: ResourceTypeXSLT}, []byte(`<xsl:stylesheet xmlns:xsl="http://www.w3.org/1999/XSL/Transform" version="1.0"/>`)))
+	require.ErrorIs(t, CheckResource(Script{Type: ResourceTypeXSLT}, []byte(`<xsl:stylesheet>`)), ErrInvalidResource)
+	require.ErrorIs(t, CheckResource(Script{Type: ResourceTypeXSD}, []byte(``)), ErrInvalidResource)
+	require.ErrorIs(t, CheckResource(Script{Type: ResourceTypeWSDL}, []byte(`<a></b>`)), ErrInvalidResource)
+
+	archive := &bytes.Buffer{}
+	zw := zip.NewWriter(archive)
+	_, err := zw.Create("META-INF/MANIFEST.MF")
+	require.NoError(t, err)
+	require.NoError(t, zw.Close())
+	require.NoError(t, CheckResource(Script{Type: ResourceTypeJAR}, archive.Bytes()))
+	require.ErrorIs(t, CheckResource(Script{Type: ResourceTypeJAR}, []byte(`not a jar`)), ErrInvalidResource)
+}
@@ -0,0 +1,94 @@
+package internal
+
+import (
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// RetryPolicy retries the calls failing with a transient error: a dropped connection,
+// 429, 502, 503 or 504. Zero fields take the value of DefaultRetryPolicy.
+type RetryPolicy struct {
+	// MaxAttempts is the number of attempts of a call, retries included.
+	MaxAttempts int `yaml:"maxAttempts,omitempty"`
+	// BaseDelay is the delay before the first retry, doubled at every retry.
+	BaseDelay time.Duration `yaml:"baseDelay,omitempty"`
+	// MaxDelay caps the backoff delay between two attempts.
+	MaxDelay time.Duration `yaml:"maxDelay,omitempty"`
+	// Deadline is the total time a call may spend retrying.
+	Deadline time.Duration `yaml:"deadline,omitempty"`
+}
+
+// DefaultRetryPolicy is the policy of a new BTPClient.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 4,
+	BaseDelay:   500 * time.Millisecond,
+	MaxDelay:    10 * time.Second,
+	Deadline:    time.Minute,
+}
+
+// withDefaults fills the zero fields of p from DefaultRetryPolicy.
+func (p RetryPolicy) withDefaults() RetryPolicy {
+	if p.MaxAttempts == 0 {
+		p.MaxAttempts = DefaultRetryPolicy.MaxAttempts
+	}
+	if p.BaseDelay == 0 {
+		p.BaseDelay = DefaultRetryPolicy.BaseDelay
+	}
+	if p.MaxDelay == 0 {
+		p.MaxDelay = DefaultRetryPolicy.MaxDelay
+	}
+	if p.Deadline == 0 {
+		p.Deadline = DefaultRetryPolicy.Deadline
+	}
+	return p
+}
+
+// backoff returns the delay before the retry following attempt (starting at 1),
+// a random value between half and all of the exponential delay.
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	delay := p.MaxDelay
+	if shift := attempt - 1; shift < 32 && p.BaseDelay<<shift < p.MaxDelay {
+		delay = p.BaseDelay << shift
+	}
+	if delay <= 0 {
+		return 0
+	}
+	return delay/2 + rand.N(delay/2+1)
+}
+
+// retryable tells whether a call may be sent again after res or err.
+// Non-idempotent requests are only retried when the server did not process them:
+// 429 and 503 are rejections, a dropped connection or a gateway error might not be.
+func retryable(method string, res *http.Response, err error) bool {
+	idempotent := method != http.MethodPost && method != http.MethodPatch
+	if err != nil {
+		return idempotent
+	}
+	switch res.StatusCode {
+	case http.StatusTooManyRequests, http.StatusServiceUnavailable:
+		return true
+	case http.StatusBadGateway, http.StatusGatewayTimeout:
+		return idempotent
+	}
+	return false
+}
+
+// retryAfter parses the Retry-After header, in seconds or as an HTTP date.
+func retryAfter(res *http.Response, now time.Time) (time.Duration, bool) {
+	if res == nil {
+		return 0, false
+	}
+	value := res.Header.Get("Retry-After")
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		return max(date.Sub(now), 0), true
+	}
+	return 0, false
+}
@@ -0,0 +1,72 @@
+package internal
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	policy := RetryPolicy{BaseDelay: time.Second, MaxDelay: 5 * time.Second}
+	for attempt, expected := range map[int]time.Duration{1: time.Second, 2: 2 * time.Second, 3: 4 * time.Second, 4: 5 * time.Second, 40: 5 * time.Second} {
+		delay := policy.backoff(attempt)
+		require.GreaterOrEqual(t, delay, expected/2)
+		require.LessOrEqual(t, delay, expected)
+	}
+}
+
+func TestRetryPolicyWithDefaults(t *testing.T) {
+	require.Equal(t, DefaultRetryPolicy, RetryPolicy{}.withDefaults())
+	require.Equal(t, 2, RetryPolicy{MaxAttempts: 2}.withDefaults().MaxAttempts)
+}
+
+func TestRetryable(t *testing.T) {
+	testCases := []struct {
+		method   string
+		status   int
+		err      error
+		expected bool
+	}{
+		{method: http.MethodGet, err: errors.New("connection reset"), expected: true},
+		{method: http.MethodPost, err: errors.New("connection reset"), expected: false},
+		{method: http.MethodPut, status: http.StatusBadGateway, expected: true},
+		{method: http.MethodDelete, status: http.StatusGatewayTimeout, expected: true},
+		{method: http.MethodPost, status: http.StatusBadGateway, expected: false},
+		{method: http.MethodPost, status: http.StatusTooManyRequests, expected: true},
+		{method: http.MethodPost, status: http.StatusServiceUnavailable, expected: true},
+		{method: http.MethodGet, status: http.StatusInternalServerError, expected: false},
+		{method: http.MethodGet, status: http.StatusOK, expected: false},
+	}
+	for _, tc := range testCases {
+		var res *http.Response
+		if tc.err == nil {
+			res = &http.Response{StatusCode: tc.status}
+		}
+		require.Equal(t, tc.expected, retryable(tc.method, res, tc.err), "%s %d %v", tc.method, tc.status, tc.err)
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	header := func(value string) *http.Response {
+		return &http.Response{Header: http.Header{"Retry-After": []string{value}}}
+	}
+	delay, ok := retryAfter(header("3"), now)
+	require.True(t, ok)
+	require.Equal(t, 3*time.Second, delay)
+	delay, ok = retryAfter(header("Wed, 01 Jan 2025 00:00:10 GMT"), now)
+	require.True(t, ok)
+	require.Equal(t, 10*time.Second, delay)
+	delay, ok = retryAfter(header("Tue, 31 Dec 2024 23:00:00 GMT"), now)
+	require.True(t, ok)
+	require.Zero(t, delay)
+	_, ok = retryAfter(header("soon"), now)
+	require.False(t, ok)
+	_, ok = retryAfter(&http.Response{}, now)
+	require.False(t, ok)
+	_, ok = retryAfter(nil, now)
+	require.False(t, ok)
+}
@@ -0,0 +1,286 @@
+package internal
+
+import (
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/goccy/go-yaml"
+)
+
+// cpiStubsVersion versions the embedded CPI stubs, it is bumped whenever they change
+// so that the stubs extracted by a previous inco version are not reused.
+const cpiStubsVersion = "1.1.0"
+
+// cpiStubs holds the CPI API stubs put on the test classpath, and the harness running case files.
+//
+//go:embed cpistubs
+var cpiStubs embed.FS
+
+const (
+	cpiStubsClasses = "classes"
+	cpiStubsHarness = "harness.groovy"
+	// defaultCaseFunction is the function of the script called by the case files.
+	defaultCaseFunction = "processData"
+)
+
+// caseFileSuffixes select the testPaths entries which are case files rather than groovy test scripts.
+var caseFileSuffixes = []string{".cases.yaml", ".cases.yml"}
+
+var ErrInvalidCaseFile = errors.New("invalid case file")
+
+// stubsCacheDir is the directory the CPI stubs are extracted into.
+var stubsCacheDir = os.UserCacheDir
+
+// CaseFile declares test cases of a CPI script: input messages and the expected output messages.
+type CaseFile struct {
+	// Script is the id of a script of uploadScripts, or the path of a script.
+	Script string `yaml:"script"`
+	// Function is the function called with the message, processData when empty.
+	Function string        `yaml:"function,omitempty"`
+	Cases    []MessageCase `yaml:"cases"`
+}
+
+// MessageCase is a message given to the script function, and the message it is expected to return.
+type MessageCase struct {
+	Name string `yaml:"name"`
+	// Function overrides the function called with the message.
+	Function string `yaml:"function,omitempty"`
+	Body     string `yaml:"body,omitempty"`
+	// BodyFile is read as body, relatively to the case file.
+	BodyFile   string          `yaml:"bodyFile,omitempty"`
+	Headers    map[string]any  `yaml:"headers,omitempty"`
+	Properties map[string]any  `yaml:"properties,omitempty"`
+	Expected   ExpectedMessage `yaml:"expected"`
+}
+
+// ExpectedMessage is compared to the message returned by the script function.
+// Only the given body, headers and properties are compared, a null header or property must be absent.
+type ExpectedMessage struct {
+	Body *string `yaml:"body,omitempty"`
+	// BodyFile is read as body, relatively to the case file.
+	BodyFile   string         `yaml:"bodyFile,omitempty"`
+	Headers    map[string]any `yaml:"headers,omitempty"`
+	Properties map[string]any `yaml:"properties,omitempty"`
+	Assertions []Assertion    `yaml:"assertions,omitempty"`
+}
+
+// Assertion checks a value of the returned message: the body, a header, a property,
+// or the result of an XPath or JSONPath expression evaluated on the body.
+type Assertion struct {
+	Header   string `yaml:"header,omitempty" json:"header,omitempty"`
+	Property string `yaml:"property,omitempty" json:"property,omitempty"`
+	XPath    string `yaml:"xpath,omitempty" json:"xpath,omitempty"`
+	JSONPath string `yaml:"jsonPath,omitempty" json:"jsonPath,omitempty"`
+	// Equals is the exact expected value.
+	Equals *string `yaml:"equals,omitempty" json:"equals,omitempty"`
+	// Matches is a Java regular expression found in the value.
+	Matches string `yaml:"matches,omitempty" json:"matches,omitempty"`
+}
+
+// check tells why the assertion is invalid, it is nil when valid.
+func (a Assertion) check() error {
+	sources := 0
+	for _, source := range []string{a.Header, a.Property, a.XPath, a.JSONPath} {
+		if source != "" {
+			sources++
+		}
+	}
+	if sources > 1 {
+		return errors.New("only one of header, property, xpath or jsonPath can be set")
+	}
+	if (a.Equals == nil) == (a.Matches == "") {
+		return errors.New("one of equals or matches is required")
+	}
+	if a.JSONPath != "" && !strings.HasPrefix(a.JSONPath, "$") {
+		return fmt.Errorf("jsonPath %q must start with $", a.JSONPath)
+	}
+	return nil
+}
+
+// caseSpec is the JSON spec read by the harness.
+type caseSpec struct {
+	Name     string         `json:"name"`
+	Script   string         `json:"script"`
+	Function string         `json:"function"`
+	Cases    []caseSpecCase `json:"cases"`
+}
+
+type caseSpecCase struct {
+	Name       string         `json:"name"`
+	Function   string         `json:"function,omitempty"`
+	Body       string         `json:"body"`
+	Headers    map[string]any `json:"headers"`
+	Properties map[string]any `json:"properties"`
+	Expected   caseSpecResult `json:"expected"`
+}
+
+type caseSpecResult struct {
+	Body       *string        `json:"body"`
+	Headers    map[string]any `json:"headers"`
+	Properties map[string]any `json:"properties"`
+	Assertions []Assertion    `json:"assertions"`
+}
+
+// isCaseFile tells whether the testPaths entry is a case file.
+func isCaseFile(path string) bool {
+	for _, suffix := range caseFileSuffixes {
+		if strings.HasSuffix(path, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// extractCPIStubs extracts the embedded stubs once per version, and returns their directory.
+func extractCPIStubs() (string, error) {
+	cacheDir, err := stubsCacheDir()
+	if err != nil {
+		cacheDir = os.TempDir()
+	}
+	dir := filepath.Join(cacheDir, "inco", "cpistubs", cpiStubsVersion)
+	if _, err := os.Stat(filepath.Join(dir, cpiStubsHarness)); err == nil {
+		return dir, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(dir), 0o755); err != nil {
+		return "", err
+	}
+	// the stubs are extracted aside then renamed, concurrent runs never see them partially written.
+	tmp, err := os.MkdirTemp(filepath.Dir(dir), cpiStubsVersion+".tmp")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(tmp)
+	stubs, err := fs.Sub(cpiStubs, "cpistubs")
+	if err != nil {
+		return "", err
+	}
+	if err := os.CopyFS(tmp, stubs); err != nil {
+		return "", err
+	}
+	if err := os.Rename(tmp, dir); err != nil {
+		if _, statErr := os.Stat(filepath.Join(dir, cpiStubsHarness)); statErr == nil {
+			return dir, nil
+		}
+		return "", err
+	}
+	return dir, nil
+}
+
+// LoadCaseFile reads the case file at path, unknown fields are rejected.
+func LoadCaseFile(path string) (CaseFile, error) {
+	var caseFile CaseFile
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return caseFile, err
+	}
+	if err := yaml.UnmarshalWithOptions(data, &caseFile, yaml.DisallowUnknownField()); err != nil {
+		return caseFile, fmt.Errorf("%w %s: %v", ErrInvalidCaseFile, path, err)
+	}
+	if caseFile.Script == "" {
+		return caseFile, fmt.Errorf("%w %s: script is required", ErrInvalidCaseFile, path)
+	}
+	for i, c := range caseFile.Cases {
+		if c.Name == "" {
+			return caseFile, fmt.Errorf("%w %s: cases[%d].name is required", ErrInvalidCaseFile, path, i)
+		}
+		for j, assertion := range c.Expected.Assertions {
+			if err := assertion.check(); err != nil {
+				return caseFile, fmt.Errorf("%w %s: cases[%d].expected.assertions[%d]: %v", ErrInvalidCaseFile, path, i, j, err)
+			}
+		}
+	}
+	return caseFile, nil
+}
+
+// writeCaseSpec writes the harness spec of the case file at path into dir, and returns its path.
+// The script is looked up by id in scripts, else it is a path.
+func writeCaseSpec(path string, scripts []Script, dir string) (string, error) {
+	caseFile, err := LoadCaseFile(path)
+	if err != nil {
+		return "", err
+	}
+	script := caseFile.Script
+	for _, s := range scripts {
+		if s.ID == caseFile.Script {
+			script = s.Path
+			break
+		}
+	}
+	if _, err := os.Stat(script); err != nil {
+		return "", fmt.Errorf("%w %s: script %q is neither a configured script id nor a file", ErrInvalidCaseFile, path, caseFile.Script)
+	}
+	spec, err := newCaseSpec(path, script, caseFile.Function, caseFile.Cases, filepath.Dir(path))
+	if err != nil {
+		return "", fmt.Errorf("%w %s: %v", ErrInvalidCaseFile, path, err)
+	}
+	return writeSpec(spec, dir)
+}
+
+// writeScriptTestsSpec writes the harness spec of the tests of script into dir, and returns its path.
+func writeScriptTestsSpec(script Script, dir string) (string, error) {
+	spec, err := newCaseSpec(script.Path, script.Path, "", script.Tests, ".")
+	if err != nil {
+		return "", fmt.Errorf("tests of script %s: %w", script.ID, err)
+	}
+	return writeSpec(spec, dir)
+}
+
+// newCaseSpec returns the harness spec of the cases of script, their body files are relative to base.
+func newCaseSpec(name, script, function string, cases []MessageCase, base string) (caseSpec, error) {
+	spec := caseSpec{Name: name, Function: function, Cases: []caseSpecCase{}}
+	if spec.Function == "" {
+		spec.Function = defaultCaseFunction
+	}
+	var err error
+	if spec.Script, err = filepath.Abs(script); err != nil {
+		return spec, err
+	}
+	for _, c := range cases {
+		specCase := caseSpecCase{Name: c.Name, Function: c.Function, Body: c.Body, Headers: c.Headers, Properties: c.Properties}
+		if c.BodyFile != "" {
+			data, err := os.ReadFile(filepath.Join(base, c.BodyFile))
+			if err != nil {
+				return spec, err
+			}
+			specCase.Body = string(data)
+		}
+		specCase.Expected = caseSpecResult{
+			Body:       c.Expected.Body,
+			Headers:    c.Expected.Headers,
+			Properties: c.Expected.Properties,
+			Assertions: c.Expected.Assertions,
+		}
+		if c.Expected.BodyFile != "" {
+			data, err := os.ReadFile(filepath.Join(base, c.Expected.BodyFile))
+			if err != nil {
+				return spec, err
+			}
+			body := string(data)
+			specCase.Expected.Body = &body
+		}
+		spec.Cases = append(spec.Cases, specCase)
+	}
+	return spec, nil
+}
+
+func writeSpec(spec caseSpec, dir string) (string, error) {
+	data, err := json.Marshal(spec)
+	if err != nil {
+		return "", err
+	}
+	specFile, err := os.CreateTemp(dir, "cases-*.json")
+	if err != nil {
+		return "", err
+	}
+	defer specFile.Close()
+	if _, err := specFile.Write(data); err != nil {
+		return "", err
+	}
+	return specFile.Name(), specFile.Close()
+}
@@ -0,0 +1,213 @@
+package internal
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestExtractCPIStubs(t *testing.T) {
+	cache := t.TempDir()
+	stubsCacheDir = func() (string, error) { return cache, nil }
+	t.Cleanup(func() { stubsCacheDir = os.UserCacheDir })
+
+	dir, err := extractCPIStubs()
+	require.NoError(t, err)
+	require.Equal(t, filepath.Join(cache, "inco", "cpistubs", cpiStubsVersion), dir)
+	require.FileExists(t, filepath.Join(dir, cpiStubsHarness))
+	require.FileExists(t, filepath.Join(dir, cpiStubsClasses, "com", "sap", "gateway", "ip", "core", "customdev", "util", "Message.groovy"))
+	require.FileExists(t, filepath.Join(dir, cpiStubsClasses, "com", "sap", "it", "api", "msglog", "MessageLogFactory.groovy"))
+	require.FileExists(t, filepath.Join(dir, cpiStubsClasses, "inco", "stubs", "SimulatedMessage.groovy"))
+
+	// extracted stubs are reused.
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "marker"), nil, 0o644))
+	again, err := extractCPIStubs()
+	require.NoError(t, err)
+	require.Equal(t, dir, again)
+	require.FileExists(t, filepath.Join(dir, "marker"))
+}
+
+func TestLoadCaseFile(t *testing.T) {
+	dir := t.TempDir()
+	write := func(content string) string {
+		path := filepath.Join(dir, "script.cases.yaml")
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+		return path
+	}
+
+	t.Run("Valid", func(t *testing.T) {
+		caseFile, err := LoadCaseFile(write(`script: script1
+cases:
+  - name: adds header
+    body: <a/>
+    headers:
+      SAPMessageId: "1"
+    expected:
+      body: <a/>
+      headers:
+        Processed: true
+        Removed: null
+`))
+		require.NoError(t, err)
+		body := "<a/>"
+		require.Equal(t, CaseFile{Script: "script1", Cases: []MessageCase{{
+			Name:     "adds header",
+			Body:     "<a/>",
+			Headers:  map[string]any{"SAPMessageId": "1"},
+			Expected: ExpectedMessage{Body: &body, Headers: map[string]any{"Processed": true, "Removed": nil}},
+		}}}, caseFile)
+	})
+
+	t.Run("UnknownField", func(t *testing.T) {
+		_, err := LoadCaseFile(write("script: script1\ncases:\n  - name: a\n    header: {}\n"))
+		require.ErrorIs(t, err, ErrInvalidCaseFile)
+		require.ErrorContains(t, err, "header")
+	})
+
+	t.Run("MissingScript", func(t *testing.T) {
+		_, err := LoadCaseFile(write("cases: []\n"))
+		require.ErrorIs(t, err, ErrInvalidCaseFile)
+		require.ErrorContains(t, err, "script is required")
+	})
+
+	t.Run("MissingName", func(t *testing.T) {
+		_, err := LoadCaseFile(write("script: script1\ncases:\n  - body: a\n"))
+		require.ErrorContains(t, err, "cases[0].name is required")
+	})
+
+	t.Run("InvalidAssertion", func(t *testing.T) {
+		_, err := LoadCaseFile(write("script: script1\ncases:\n  - name: a\n    expected:\n      assertions:\n        - jsonPath: id\n          equals: 1\n"))
+		require.ErrorIs(t, err, ErrInvalidCaseFile)
+		require.ErrorContains(t, err, `cases[0].expected.assertions[0]: jsonPath "id" must start with $`)
+	})
+}
+
+func TestWriteCaseSpec(t *testing.T) {
+	dir := t.TempDir()
+	t.Chdir(dir)
+	require.NoError(t, os.MkdirAll("src", 0o755))
+	require.NoError(t, os.MkdirAll("tests/data", 0o755))
+	require.NoError(t, os.WriteFile("src/script1.groovy", []byte("def processData(message) { message }"), 0o644))
+	require.NoError(t, os.WriteFile("tests/data/input.xml", []byte("<in/>"), 0o644))
+	require.NoError(t, os.WriteFile("tests/data/output.xml", []byte("<out/>"), 0o644))
+	scripts := []Script{{ID: "script1", Path: "src/script1.groovy"}}
+
+	t.Run("ScriptID", func(t *testing.T) {
+		path := "tests/script1.cases.yaml"
+		require.NoError(t, os.WriteFile(path, []byte(`script: script1
+function: transform
+cases:
+  - name: maps
+    bodyFile: data/input.xml
+    properties:
+      count: 2
+    expected:
+      bodyFile: data/output.xml
+`), 0o644))
+		specPath, err := writeCaseSpec(path, scripts, t.TempDir())
+		require.NoError(t, err)
+		data, err := os.ReadFile(specPath)
+		require.NoError(t, err)
+		var spec caseSpec
+		require.NoError(t, json.Unmarshal(data, &spec))
+		output := "<out/>"
+		require.Equal(t, caseSpec{
+			Name:     path,
+			Script:   filepath.Join(dir, "src", "script1.groovy"),
+			Function: "transform",
+			Cases: []caseSpecCase{{
+				Name:       "maps",
+				Body:       "<in/>",
+				Properties: map[string]any{"count": float64(2)},
+				Expected:   caseSpecResult{Body: &output},
+			}},
+		}, spec)
+	})
+
+	t.Run("ScriptPath", func(t *testing.T) {
+		path := "tests/path.cases.yaml"
+		require.NoError(t, os.WriteFile(path, []byte("script: src/script1.groovy\ncases: []\n"), 0o644))
+		specPath, err := writeCaseSpec(path, nil, t.TempDir())
+		require.NoError(t, err)
+		data, err := os.ReadFile(specPath)
+		require.NoError(t, err)
+		var spec caseSpec
+		require.NoError(t, json.Unmarshal(data, &spec))
+		require.Equal(t, defaultCaseFunction, spec.Function)
+		require.Equal(t, filepath.Join(dir, "src", "script1.groovy"), spec.Script)
+	})
+
+	t.Run("UnknownScript", func(t *testing.T) {
+		path := "tests/unknown.cases.yaml"
+		require.NoError(t, os.WriteFile(path, []byte("script: script2\ncases: []\n"), 0o644))
+		_, err := writeCaseSpec(path, scripts, t.TempDir())
+		require.ErrorIs(t, err, ErrInvalidCaseFile)
+		require.ErrorContains(t, err, `script "script2" is neither a configured script id nor a file`)
+	})
+}
+
+func TestExecuteTestsCaseFile(t *testing.T) {
+	// the fake groovy prints the harness it runs, and the tree of the spec it is given.
+	fakeGroovy(t, "echo \"$3\"\ngrep -q '\"name\":\"maps\"' \"$4\" || exit 2\necho '└─ tests/script1.cases.yaml ✘'\necho '   └─ maps ✘ body: expected \"<out/>\"'\nexit 1\n")
+	dir := t.TempDir()
+	t.Chdir(dir)
+	require.NoError(t, os.WriteFile("script1.groovy", nil, 0o644))
+	require.NoError(t, os.MkdirAll("tests", 0o755))
+	require.NoError(t, os.WriteFile("tests/script1.cases.yaml", []byte("script: script1\ncases:\n  - name: maps\n"), 0o644))
+
+	results, err := ExecuteTests(t.Context(), []string{"tests/script1.cases.yaml"}, []Script{{ID: "script1", Path: "script1.groovy"}}, io.Discard, io.Discard, TestOptions{})
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	require.Equal(t, 1, results[0].ExitCode)
+	stubs, err := extractCPIStubs()
+	require.NoError(t, err)
+	require.Contains(t, results[0].Stdout, filepath.Join(stubs, cpiStubsHarness)+"\n")
+	require.Equal(t, []TestCase{{Name: "maps", ClassName: "tests/script1.cases.yaml", Failure: `body: expected "<out/>"`}}, results[0].Cases)
+
+	t.Run("InvalidCaseFile", func(t *testing.T) {
+		require.NoError(t, os.WriteFile("tests/invalid.cases.yaml", []byte("cases: []\n"), 0o644))
+		results, err := ExecuteTests(t.Context(), []string{"tests/invalid.cases.yaml"}, nil, io.Discard, io.Discard, TestOptions{})
+		require.NoError(t, err)
+		require.ErrorIs(t, results[0].Err, ErrInvalidCaseFile)
+		require.False(t, TestsPassed(results))
+	})
+}
+
+func TestExecuteTestsScriptTests(t *testing.T) {
+	// the fake groovy prints the spec it is given.
+	fakeGroovy(t, "cat \"$4\"\n")
+	dir := t.TempDir()
+	t.Chdir(dir)
+	require.NoError(t, os.WriteFile("script1.groovy", nil, 0o644))
+	require.NoError(t, os.WriteFile("input.json", []byte(`{"id":1}`), 0o644))
+	equals := "1"
+	script := Script{ID: "script1", Path: "script1.groovy", Tests: []MessageCase{{
+		Name:     "maps",
+		Function: "transform",
+		BodyFile: "input.json",
+		Expected: ExpectedMessage{Assertions: []Assertion{{JSONPath: "$.id", Equals: &equals}}},
+	}}}
+
+	// a script of several iflows is tested once.
+	results, err := ExecuteTests(t.Context(), nil, []Script{script, {ID: "script2", Path: "script1.groovy"}, script}, io.Discard, io.Discard, TestOptions{})
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	require.Equal(t, "script1.groovy", results[0].Path)
+	var spec caseSpec
+	require.NoError(t, json.Unmarshal([]byte(results[0].Stdout), &spec))
+	require.Equal(t, caseSpec{
+		Name:     "script1.groovy",
+		Script:   filepath.Join(dir, "script1.groovy"),
+		Function: defaultCaseFunction,
+		Cases: []caseSpecCase{{
+			Name:     "maps",
+			Function: "transform",
+			Body:     `{"id":1}`,
+			Expected: caseSpecResult{Assertions: []Assertion{{JSONPath: "$.id", Equals: &equals}}},
+		}},
+	}, spec)
+}
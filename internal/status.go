@@ -0,0 +1,139 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+const (
+	// StatusFormatTable prints artifact states as a table.
+	StatusFormatTable = "table"
+	// StatusFormatJSON prints artifact states as a JSON array.
+	StatusFormatJSON = "json"
+
+	runtimeStatusNotDeployed = "NOT_DEPLOYED"
+)
+
+var (
+	ErrNotStarted          = errors.New("some artifacts are not started")
+	ErrUnknownStatusFormat = errors.New("unknown status format")
+
+	odataDateRegexp = regexp.MustCompile(`^/Date\((-?\d+)([+-]\d{4})?\)/$`)
+)
+
+// ArtifactStatus is the reported runtime state of a manifest iflow.
+type ArtifactStatus struct {
+	ID         string `json:"id"`
+	Version    string `json:"version"`
+	Status     string `json:"status"`
+	DeployedBy string `json:"deployedBy"`
+	DeployedOn string `json:"deployedOn"`
+	Error      string `json:"error,omitempty"`
+}
+
+// DeployStatus authenticates over oauth2, then reports the runtime state of every iflow.
+// It returns ErrNotStarted when at least one iflow is not started.
+func DeployStatus(ctx context.Context, client IBTPClient, iflows []Iflow, format string, w io.Writer) error {
+	if format != StatusFormatTable && format != StatusFormatJSON {
+		return fmt.Errorf("%w: %s", ErrUnknownStatusFormat, format)
+	}
+	if err := client.RequestToken(ctx); err != nil {
+		return fmt.Errorf("RequestToken: %w", err)
+	}
+
+	statuses := make([]ArtifactStatus, 0, len(iflows))
+	for _, iflow := range iflows {
+		status, err := getArtifactStatus(ctx, client, iflow.ID)
+		if err != nil {
+			return err
+		}
+		statuses = append(statuses, status)
+	}
+
+	var err error
+	if format == StatusFormatJSON {
+		err = printStatusesJSON(statuses, w)
+	} else {
+		err = printStatusesTable(statuses, w)
+	}
+	if err != nil {
+		return err
+	}
+	for _, status := range statuses {
+		if status.Status != RuntimeStatusStarted {
+			return ErrNotStarted
+		}
+	}
+	return nil
+}
+
+func getArtifactStatus(ctx context.Context, client IBTPClient, id string) (ArtifactStatus, error) {
+	artifact, err := client.GetRuntimeArtifact(ctx, id)
+	if errors.Is(err, ErrArtifactNotFound) {
+		return ArtifactStatus{ID: id, Status: runtimeStatusNotDeployed}, nil
+	}
+	if err != nil {
+		return ArtifactStatus{}, fmt.Errorf("GetRuntimeArtifact %s: %w", id, err)
+	}
+	status := ArtifactStatus{
+		ID:         id,
+		Version:    artifact.Version,
+		Status:     artifact.Status,
+		DeployedBy: artifact.DeployedBy,
+		DeployedOn: formatODataDate(artifact.DeployedOn),
+	}
+	if artifact.Status == RuntimeStatusError {
+		// the status is still reported when its error details cannot be fetched.
+		errorInformation, err := client.GetRuntimeArtifactError(ctx, id)
+		if err != nil {
+			status.Error = fmt.Sprintf("error details unavailable: %v", err)
+		} else {
+			status.Error = strings.TrimSpace(errorInformation)
+		}
+	}
+	return status, nil
+}
+
+func printStatusesJSON(statuses []ArtifactStatus, w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(statuses)
+}
+
+func printStatusesTable(statuses []ArtifactStatus, w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tVERSION\tSTATUS\tDEPLOYED BY\tDEPLOYED ON")
+	for _, status := range statuses {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", status.ID, status.Version, status.Status, status.DeployedBy, status.DeployedOn)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	for _, status := range statuses {
+		if status.Error != "" {
+			fmt.Fprintf(w, "\nError %s:\n%s\n", status.ID, status.Error)
+		}
+	}
+	return nil
+}
+
+// formatODataDate converts OData `/Date(ms)/` values to RFC3339, other values are kept as is.
+func formatODataDate(value string) string {
+	matches := odataDateRegexp.FindStringSubmatch(value)
+	if matches == nil {
+		return value
+	}
+	ms, err := strconv.ParseInt(matches[1], 10, 64)
+	if err != nil {
+		return value
+	}
+	return time.UnixMilli(ms).UTC().Format(time.RFC3339)
+}
@@ -0,0 +1,73 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeployStatus(t *testing.T) {
+	iflows := []Iflow{{ID: "iflow1"}, {ID: "iflow2"}}
+	t.Run("UnknownFormat", func(t *testing.T) {
+		require.ErrorIs(t, DeployStatus(t.Context(), &BTPClientMock{}, iflows, "xml", &bytes.Buffer{}), ErrUnknownStatusFormat)
+	})
+	t.Run("FailingRequestToken", func(t *testing.T) {
+		mockedClient := BTPClientMock{requestTokenError: ErrUnexpectedStatusCode}
+		require.ErrorIs(t, DeployStatus(t.Context(), &mockedClient, iflows, StatusFormatTable, &bytes.Buffer{}), ErrUnexpectedStatusCode)
+	})
+	t.Run("AllStarted", func(t *testing.T) {
+		mockedClient := BTPClientMock{runtimeArtifacts: []RuntimeArtifact{
+			{ID: "iflow1", Version: "1.0.0", Status: RuntimeStatusStarted, DeployedBy: "alice", DeployedOn: "/Date(1700000000000)/"},
+			{ID: "iflow2", Version: "1.0.1", Status: RuntimeStatusStarted, DeployedBy: "bob", DeployedOn: "/Date(1700000000000)/"},
+		}}
+		out := &bytes.Buffer{}
+		require.NoError(t, DeployStatus(t.Context(), &mockedClient, iflows, StatusFormatTable, out))
+		require.Contains(t, out.String(), "iflow1  1.0.0    STARTED  alice        2023-11-14T22:13:20Z")
+	})
+	t.Run("OneInError", func(t *testing.T) {
+		mockedClient := BTPClientMock{
+			runtimeArtifacts: []RuntimeArtifact{
+				{ID: "iflow1", Version: "1.0.0", Status: RuntimeStatusStarted},
+				{ID: "iflow2", Version: "1.0.1", Status: RuntimeStatusError},
+			},
+			runtimeErrors: map[string]string{"iflow2": "{\"message\":\"bundle failed\"}\n"},
+		}
+		out := &bytes.Buffer{}
+		require.ErrorIs(t, DeployStatus(t.Context(), &mockedClient, iflows, StatusFormatJSON, out), ErrNotStarted)
+		var statuses []ArtifactStatus
+		require.NoError(t, json.Unmarshal(out.Bytes(), &statuses))
+		require.Equal(t, []ArtifactStatus{
+			{ID: "iflow1", Version: "1.0.0", Status: RuntimeStatusStarted},
+			{ID: "iflow2", Version: "1.0.1", Status: RuntimeStatusError, Error: "{\"message\":\"bundle failed\"}"},
+		}, statuses)
+	})
+	t.Run("ErrorDetailsUnavailable", func(t *testing.T) {
+		mockedClient := BTPClientMock{runtimeArtifacts: []RuntimeArtifact{
+			{ID: "iflow1", Version: "1.0.0", Status: RuntimeStatusError},
+			{ID: "iflow2", Version: "1.0.1", Status: RuntimeStatusStarted},
+		}}
+		out := &bytes.Buffer{}
+		require.ErrorIs(t, DeployStatus(t.Context(), &mockedClient, iflows, StatusFormatJSON, out), ErrNotStarted)
+		var statuses []ArtifactStatus
+		require.NoError(t, json.Unmarshal(out.Bytes(), &statuses))
+		require.Equal(t, []ArtifactStatus{
+			{ID: "iflow1", Version: "1.0.0", Status: RuntimeStatusError, Error: "error details unavailable: " + ErrArtifactNotFound.Error()},
+			{ID: "iflow2", Version: "1.0.1", Status: RuntimeStatusStarted},
+		}, statuses)
+	})
+	t.Run("NotDeployed", func(t *testing.T) {
+		mockedClient := BTPClientMock{runtimeArtifacts: []RuntimeArtifact{{}, {ID: "iflow2", Status: RuntimeStatusStarted}}}
+		out := &bytes.Buffer{}
+		require.ErrorIs(t, DeployStatus(t.Context(), &mockedClient, iflows, StatusFormatTable, out), ErrNotStarted)
+		require.Contains(t, out.String(), runtimeStatusNotDeployed)
+	})
+}
+
+func TestFormatODataDate(t *testing.T) {
+	require.Equal(t, "2023-11-14T22:13:20Z", formatODataDate("/Date(1700000000000)/"))
+	require.Equal(t, "2023-11-14T22:13:20Z", formatODataDate("/Date(1700000000000+0000)/"))
+	require.Equal(t, "", formatODataDate(""))
+	require.Equal(t, "yesterday", formatODataDate("yesterday"))
+}
@@ -0,0 +1,347 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/goccy/go-yaml"
+	"github.com/goccy/go-yaml/ast"
+	"github.com/goccy/go-yaml/parser"
+)
+
+var versionRegexp = regexp.MustCompile(`^\d+\.\d+\.\d+$`)
+
+// ConfigError is a configuration problem located in the manifest.
+type ConfigError struct {
+	File    string
+	Line    int
+	Column  int
+	Field   string
+	Message string
+}
+
+func (e ConfigError) Error() string {
+	location := fmt.Sprintf("%d:%d", e.Line, e.Column)
+	if e.File != "" {
+		location = fmt.Sprintf("%s:%s", e.File, location)
+	}
+	if e.Field == "" {
+		return fmt.Sprintf("%s: %s", location, e.Message)
+	}
+	return fmt.Sprintf("%s: %s: %s", location, e.Field, e.Message)
+}
+
+// ConfigErrors gathers every configuration problem of the manifest.
+type ConfigErrors []ConfigError
+
+func (e ConfigErrors) Error() string {
+	lines := make([]string, 0, len(e))
+	for _, err := range e {
+		lines = append(lines, err.Error())
+	}
+	return strings.Join(lines, "\n")
+}
+
+// WithFile sets the manifest file name reported by every error.
+func (e ConfigErrors) WithFile(file string) ConfigErrors {
+	for i := range e {
+		e[i].File = file
+	}
+	return e
+}
+
+// configValidator records the position of every manifest node, keyed by field path.
+type configValidator struct {
+	nodes  map[string]ast.Node
+	errors ConfigErrors
+}
+
+// decodeConfig parses the manifest, reports unknown fields, then decodes and validates it.
+func decodeConfig(data []byte, cfg *Config, checks ConfigChecks) ConfigErrors {
+	file, err := parser.ParseBytes(data, 0)
+	if err != nil {
+		return ConfigErrors{yamlConfigError(err)}
+	}
+	v := &configValidator{nodes: map[string]ast.Node{}}
+	for _, doc := range file.Docs {
+		if doc.Body != nil {
+			v.walk(doc.Body, reflect.TypeOf(*cfg), "")
+		}
+	}
+	// unknown fields are ignored by the decoding, the other problems are still reported.
+	if err := yaml.Unmarshal(data, cfg); err != nil {
+		return append(v.errors, yamlConfigError(err))
+	}
+	v.validate(cfg, checks)
+	return v.errors
+}
+
+func yamlConfigError(err error) ConfigError {
+	var yamlErr yaml.Error
+	if errors.As(err, &yamlErr) && yamlErr.GetToken() != nil {
+		position := yamlErr.GetToken().Position
+		return ConfigError{Line: position.Line, Column: position.Column, Message: yamlErr.GetMessage()}
+	}
+	return ConfigError{Line: 1, Column: 1, Message: err.Error()}
+}
+
+// walk records node positions and reports keys not matching a yaml tag of t.
+func (v *configValidator) walk(node ast.Node, t reflect.Type, path string) {
+	node = unwrapNode(node)
+	v.nodes[path] = node
+	switch t.Kind() {
+	case reflect.Pointer:
+		v.walk(node, t.Elem(), path)
+	case reflect.Slice:
+		sequence, ok := node.(*ast.SequenceNode)
+		if !ok {
+			return
+		}
+		for i, value := range sequence.Values {
+			v.walk(value, t.Elem(), fmt.Sprintf("%s[%d]", path, i))
+		}
+	case reflect.Struct:
+		for _, value := range mappingValues(node) {
+			key := value.Key.String()
+			field, ok := yamlField(t, key)
+			if !ok {
+				v.add(value.Key, joinPath(path, key), "unknown field")
+				continue
+			}
+			v.nodes[joinPath(path, key)] = value.Value
+			v.walk(value.Value, field.Type, joinPath(path, key))
+		}
+	}
+}
+
+func unwrapNode(node ast.Node) ast.Node {
+	for {
+		switch n := node.(type) {
+		case *ast.AnchorNode:
+			node = n.Value
+		case *ast.TagNode:
+			node = n.Value
+		default:
+			return node
+		}
+	}
+}
+
+func mappingValues(node ast.Node) []*ast.MappingValueNode {
+	switch n := node.(type) {
+	case *ast.MappingNode:
+		return n.Values
+	case *ast.MappingValueNode:
+		return []*ast.MappingValueNode{n}
+	}
+	return nil
+}
+
+func yamlField(t reflect.Type, key string) (reflect.StructField, bool) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+		if name == key {
+			return field, true
+		}
+	}
+	return reflect.StructField{}, false
+}
+
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+// add reports a problem at the position of node.
+func (v *configValidator) add(node ast.Node, field, message string) {
+	err := ConfigError{Line: 1, Column: 1, Field: field, Message: message}
+	// mappings are located at their first key rather than at its ':' delimiter.
+	if values := mappingValues(node); len(values) > 0 {
+		node = values[0].Key
+	}
+	if node != nil && node.GetToken() != nil {
+		err.Line = node.GetToken().Position.Line
+		err.Column = node.GetToken().Position.Column
+	}
+	v.errors = append(v.errors, err)
+}
+
+// addAt reports a problem on field, located at the closest recorded node.
+func (v *configValidator) addAt(field, message string) {
+	path := field
+	for {
+		if node, ok := v.nodes[path]; ok {
+			v.add(node, field, message)
+			return
+		}
+		index := strings.LastIndexAny(path, ".[")
+		if index < 0 {
+			v.add(v.nodes[""], field, message)
+			return
+		}
+		path = path[:index]
+	}
+}
+
+func (v *configValidator) validate(cfg *Config, checks ConfigChecks) {
+	v.validateURL("tokenURL", cfg.IntegrationSuiteTokenURL)
+	v.validateURL("url", cfg.IntegrationSuiteAPIURL)
+	v.validateDuration("test.timeout", cfg.Test.Timeout)
+	if cfg.Test.Parallel < 0 {
+		v.addAt("test.parallel", fmt.Sprintf("%d must not be negative", cfg.Test.Parallel))
+	}
+	if checks.Tests {
+		for i, entry := range cfg.Test.Classpath {
+			field := fmt.Sprintf("test.classpath[%d]", i)
+			if !hasGlobMeta(filepath.ToSlash(entry)) {
+				v.validatePath(field, entry)
+			} else if _, err := expandClasspath([]string{entry}, false); err != nil {
+				v.addAt(field, err.Error())
+			}
+		}
+	}
+	if cfg.Test.WorkingDir != "" && checks.Tests {
+		if info, err := os.Stat(cfg.Test.WorkingDir); err != nil || !info.IsDir() {
+			v.addAt("test.workingDir", fmt.Sprintf("%q is not a directory", cfg.Test.WorkingDir))
+		}
+	}
+	for _, key := range slices.Sorted(maps.Keys(cfg.Test.Env)) {
+		if key == "" || strings.Contains(key, "=") {
+			v.addAt("test.env", fmt.Sprintf("%q is not a valid environment variable name", key))
+		}
+	}
+	if cfg.Test.Coverage.JaCoCoHome != "" && checks.Tests {
+		v.validatePath("test.coverage.jacocoHome", cfg.Test.Coverage.JaCoCoHome)
+	}
+	if minimum := cfg.Test.Coverage.MinLineCoverage; minimum < 0 || minimum > 100 {
+		v.addAt("test.coverage.minLineCoverage", fmt.Sprintf("%g must be between 0 and 100", minimum))
+	}
+	if cfg.Concurrency < 0 {
+		v.addAt("concurrency", fmt.Sprintf("%d must not be negative", cfg.Concurrency))
+	}
+	if cfg.Retry.MaxAttempts < 0 {
+		v.addAt("retry.maxAttempts", fmt.Sprintf("%d must not be negative", cfg.Retry.MaxAttempts))
+	}
+	v.validateDuration("retry.baseDelay", cfg.Retry.BaseDelay)
+	v.validateDuration("retry.maxDelay", cfg.Retry.MaxDelay)
+	v.validateDuration("retry.deadline", cfg.Retry.Deadline)
+	if _, ok := v.nodes["testPaths"]; !ok {
+		v.addAt("testPaths", "required")
+	}
+	exclusions := testPathExclusions(cfg.TestPaths)
+	for i, entry := range cfg.TestPaths {
+		field := fmt.Sprintf("testPaths[%d]", i)
+		pattern, exclusion := strings.CutPrefix(entry, "!")
+		if exclusion || !checks.Tests {
+			if _, err := path.Match(filepath.ToSlash(pattern), ""); err != nil {
+				v.addAt(field, fmt.Sprintf("%q is not a valid pattern", pattern))
+			}
+			continue
+		}
+		if _, err := expandIncludedTestPath(entry, exclusions); err != nil {
+			v.addAt(field, err.Error())
+		}
+	}
+	if len(cfg.UploadScripts) == 0 {
+		v.addAt("uploadScripts", "required")
+	}
+	for i := range cfg.UploadScripts {
+		iflow := &cfg.UploadScripts[i]
+		field := fmt.Sprintf("uploadScripts[%d]", i)
+		v.validateRequired(field+".id", iflow.ID)
+		if v.validateRequired(field+".version", iflow.Version) && iflow.Version != "active" && !versionRegexp.MatchString(iflow.Version) {
+			v.addAt(field+".version", fmt.Sprintf("%q must be `active` or a x.x.x version", v.raw(field+".version", iflow.Version)))
+		}
+		if iflow.Path == "" && len(iflow.Scripts) == 0 {
+			v.addAt(field+".scripts", "required unless path is set")
+		}
+		if iflow.Path != "" && checks.Scripts {
+			if _, err := os.Stat(filepath.Join(iflow.Path, manifestPath)); err != nil {
+				v.addAt(field+".path", fmt.Sprintf("%q is not an unpacked iflow directory: %s not found", iflow.Path, manifestPath))
+			}
+		}
+		for j := range iflow.Scripts {
+			script := &iflow.Scripts[j]
+			field := fmt.Sprintf("%s.scripts[%d]", field, j)
+			v.validateRequired(field+".id", script.ID)
+			if v.validateRequired(field+".type", script.Type) {
+				resourceType, err := ResolveResourceType(script.Type)
+				if err != nil {
+					v.addAt(field+".type", err.Error())
+				} else {
+					script.Type = resourceType
+				}
+			}
+			if v.validateRequired(field+".path", script.Path) && checks.Scripts {
+				v.validatePath(field+".path", script.Path)
+			}
+			for k, test := range script.Tests {
+				field := fmt.Sprintf("%s.tests[%d]", field, k)
+				v.validateRequired(field+".name", test.Name)
+				if test.BodyFile != "" && checks.Tests {
+					v.validatePath(field+".bodyFile", test.BodyFile)
+				}
+				if test.Expected.BodyFile != "" && checks.Tests {
+					v.validatePath(field+".expected.bodyFile", test.Expected.BodyFile)
+				}
+				for n, assertion := range test.Expected.Assertions {
+					if err := assertion.check(); err != nil {
+						v.addAt(fmt.Sprintf("%s.expected.assertions[%d]", field, n), err.Error())
+					}
+				}
+			}
+		}
+	}
+}
+
+// raw returns the text of the field as written in the manifest, value when the field is not found.
+func (v *configValidator) raw(field, value string) string {
+	if node, ok := v.nodes[field]; ok && node != nil && node.GetToken() != nil {
+		return node.GetToken().Value
+	}
+	return value
+}
+
+func (v *configValidator) validateRequired(field, value string) bool {
+	if value == "" {
+		v.addAt(field, "required")
+		return false
+	}
+	return true
+}
+
+func (v *configValidator) validatePath(field, path string) {
+	if _, err := os.Stat(path); err != nil {
+		v.addAt(field, fmt.Sprintf("%q does not exist", path))
+	}
+}
+
+func (v *configValidator) validateDuration(field string, value time.Duration) {
+	if value < 0 {
+		v.addAt(field, fmt.Sprintf("%s must not be negative", value))
+	}
+}
+
+// validateURL checks an optional absolute http(s) URL.
+func (v *configValidator) validateURL(field, value string) {
+	if value == "" {
+		return
+	}
+	u, err := url.Parse(value)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		v.addAt(field, fmt.Sprintf("%q is not a valid http(s) URL", value))
+	}
+}
@@ -0,0 +1,287 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultWatchInterval = 500 * time.Millisecond
+	DefaultWatchDebounce = 300 * time.Millisecond
+)
+
+// WatchOptions tunes Watch.
+type WatchOptions struct {
+	// Interval is the delay between two scans of the watched files, DefaultWatchInterval when zero.
+	Interval time.Duration
+	// Debounce is the delay without change before the changes are handled, DefaultWatchDebounce when zero.
+	Debounce time.Duration
+}
+
+// fileStamp tells a file changed when its modification time or its size differ.
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+// Watch scans the files under the roots every interval, and calls onChange with the sorted paths
+// created, modified or removed, once no change happened for the debounce delay.
+// Roots are files or directories, missing roots are watched until they are created,
+// roots is called at every scan so that they may change. Watch returns nil when ctx is done.
+func Watch(ctx context.Context, roots func() []string, opts WatchOptions, onChange func([]string)) error {
+	if opts.Interval <= 0 {
+		opts.Interval = DefaultWatchInterval
+	}
+	if opts.Debounce <= 0 {
+		opts.Debounce = DefaultWatchDebounce
+	}
+	w, err := newWatcher(roots, opts.Debounce)
+	if err != nil {
+		return err
+	}
+	ticker := time.NewTicker(opts.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case now := <-ticker.C:
+			changed, err := w.scan(now)
+			if err != nil {
+				return err
+			}
+			if len(changed) > 0 {
+				onChange(changed)
+			}
+		}
+	}
+}
+
+// watcher accumulates the changes of the files under the roots between scans.
+type watcher struct {
+	roots      func() []string
+	debounce   time.Duration
+	snapshot   map[string]fileStamp
+	pending    map[string]bool
+	lastChange time.Time
+}
+
+// newWatcher takes the snapshot the first scan is compared to.
+func newWatcher(roots func() []string, debounce time.Duration) (*watcher, error) {
+	snapshot, err := snapshotFiles(roots())
+	if err != nil {
+		return nil, err
+	}
+	return &watcher{roots: roots, debounce: debounce, snapshot: snapshot, pending: map[string]bool{}}, nil
+}
+
+// scan compares the files to the previous scan at now, and returns the changed paths to handle,
+// none until no change happened for the debounce delay.
+func (w *watcher) scan(now time.Time) ([]string, error) {
+	current, err := snapshotFiles(w.roots())
+	if err != nil {
+		return nil, err
+	}
+	if changed := changedFiles(w.snapshot, current); len(changed) > 0 {
+		for _, path := range changed {
+			w.pending[path] = true
+		}
+		w.lastChange = now
+	}
+	w.snapshot = current
+	if len(w.pending) == 0 || now.Sub(w.lastChange) < w.debounce {
+		return nil, nil
+	}
+	changed := slices.Sorted(maps.Keys(w.pending))
+	clear(w.pending)
+	return changed, nil
+}
+
+// snapshotFiles stamps the regular files under the roots, hidden directories aside.
+func snapshotFiles(roots []string) (map[string]fileStamp, error) {
+	snapshot := map[string]fileStamp{}
+	for _, root := range roots {
+		err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				// roots and files may be removed while walking.
+				if os.IsNotExist(err) {
+					return nil
+				}
+				return err
+			}
+			if d.IsDir() && path != root && strings.HasPrefix(d.Name(), ".") {
+				return fs.SkipDir
+			}
+			if !d.Type().IsRegular() {
+				return nil
+			}
+			info, err := d.Info()
+			if err != nil {
+				if os.IsNotExist(err) {
+					return nil
+				}
+				return err
+			}
+			snapshot[filepath.Clean(path)] = fileStamp{modTime: info.ModTime(), size: info.Size()}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return snapshot, nil
+}
+
+// changedFiles returns the sorted paths created, modified or removed between the snapshots.
+func changedFiles(previous, current map[string]fileStamp) []string {
+	var changed []string
+	for path, stamp := range current {
+		if old, ok := previous[path]; !ok || !old.modTime.Equal(stamp.modTime) || old.size != stamp.size {
+			changed = append(changed, path)
+		}
+	}
+	for path := range previous {
+		if _, ok := current[path]; !ok {
+			changed = append(changed, path)
+		}
+	}
+	slices.Sort(changed)
+	return changed
+}
+
+// WatchRoots returns the files and directories watched for the config: src, the test paths and the scripts.
+func WatchRoots(cfg Config, configPath string) []string {
+	roots := []string{configPath, "src"}
+	for _, entry := range cfg.TestPaths {
+		if strings.HasPrefix(entry, "!") {
+			continue
+		}
+		if hasGlobMeta(filepath.ToSlash(entry)) {
+			entry = filepath.FromSlash(globRoot(filepath.ToSlash(entry)))
+		}
+		roots = append(roots, entry)
+	}
+	for _, iflow := range cfg.UploadScripts {
+		for _, script := range iflow.Scripts {
+			roots = append(roots, script.Path)
+		}
+	}
+	var unique []string
+	for _, root := range roots {
+		root = filepath.Clean(root)
+		if !slices.Contains(unique, root) {
+			unique = append(unique, root)
+		}
+	}
+	return unique
+}
+
+// AffectedTests returns the test paths and the scripts with tests affected by the changed files.
+// A test path is affected when it changed, when it is a case file whose script or body files changed,
+// or when it is a test script mentioning a changed file, by its file name or, for a groovy file, its class name.
+// A script with tests is affected when it changed or when the body files of its tests changed.
+// The returned scripts are all the scripts, for the case files to resolve them, without the tests of the unaffected ones.
+func AffectedTests(changed, paths []string, scripts []Script) ([]string, []Script) {
+	isChanged := map[string]bool{}
+	for _, path := range changed {
+		isChanged[filepath.Clean(path)] = true
+	}
+	// a changed file is mentioned by its file name, or by its class name for a groovy file.
+	mentions := make([]*regexp.Regexp, 0, len(changed))
+	for _, path := range changed {
+		base := filepath.Base(path)
+		name := regexp.QuoteMeta(base)
+		if filepath.Ext(base) == ".groovy" {
+			name += "|" + regexp.QuoteMeta(strings.TrimSuffix(base, ".groovy"))
+		}
+		mentions = append(mentions, regexp.MustCompile(`(?:^|[^\w$])(?:`+name+`)(?:$|[^\w$])`))
+	}
+
+	var affectedPaths []string
+	for _, path := range paths {
+		if isChanged[filepath.Clean(path)] || (isCaseFile(path) && caseFileAffected(path, scripts, isChanged)) {
+			affectedPaths = append(affectedPaths, path)
+			continue
+		}
+		if isCaseFile(path) {
+			continue
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		if slices.ContainsFunc(mentions, func(mention *regexp.Regexp) bool { return mention.Match(data) }) {
+			affectedPaths = append(affectedPaths, path)
+		}
+	}
+
+	affectedScripts := slices.Clone(scripts)
+	for i, script := range affectedScripts {
+		if len(script.Tests) > 0 && !isChanged[filepath.Clean(script.Path)] && !casesAffected(script.Tests, ".", isChanged) {
+			affectedScripts[i].Tests = nil
+		}
+	}
+	return affectedPaths, affectedScripts
+}
+
+// caseFileAffected tells whether the script or the body files of the case file at path changed.
+func caseFileAffected(path string, scripts []Script, isChanged map[string]bool) bool {
+	caseFile, err := LoadCaseFile(path)
+	if err != nil {
+		return false
+	}
+	script := caseFile.Script
+	for _, s := range scripts {
+		if s.ID == caseFile.Script {
+			script = s.Path
+			break
+		}
+	}
+	return isChanged[filepath.Clean(script)] || casesAffected(caseFile.Cases, filepath.Dir(path), isChanged)
+}
+
+// casesAffected tells whether a body file of the cases changed, body files are relative to base.
+func casesAffected(cases []MessageCase, base string, isChanged map[string]bool) bool {
+	for _, c := range cases {
+		for _, bodyFile := range []string{c.BodyFile, c.Expected.BodyFile} {
+			if bodyFile != "" && isChanged[filepath.Join(base, bodyFile)] {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// UploadChangedScripts uploads the scripts of the iflows whose path changed, one at a time,
+// checked and reported as by UploadScripts.
+// The client tokens are requested on the first upload and renewed when they expire,
+// so that a client uploads every change over the same session.
+func UploadChangedScripts(ctx context.Context, client IBTPClient, readFile func(string) ([]byte, error), iflows []Iflow, changed []string) error {
+	isChanged := map[string]bool{}
+	for _, path := range changed {
+		isChanged[filepath.Clean(path)] = true
+	}
+	var uploadErr error
+	for i, iflow := range iflows {
+		for _, script := range iflow.Scripts {
+			if !isChanged[filepath.Clean(script.Path)] {
+				continue
+			}
+			job := uploadJob{iflow: i, script: script}
+			uploadScript(ctx, client, readFile, iflow, &job, UploadOptions{})
+			fmt.Print(job.output.String())
+			if job.failed {
+				uploadErr = fmt.Errorf("some reading/uploading scripts failed")
+			}
+		}
+	}
+	return uploadErr
+}
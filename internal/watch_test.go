@@ -0,0 +1,149 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWatch(t *testing.T) {
+	dir := t.TempDir()
+	ctx, cancel := context.WithCancel(t.Context())
+	done := make(chan error)
+	go func() {
+		done <- Watch(ctx, func() []string { return []string{dir} }, WatchOptions{Interval: time.Millisecond}, func([]string) {})
+	}()
+	cancel()
+	require.NoError(t, <-done)
+}
+
+func TestWatcher(t *testing.T) {
+	dir := t.TempDir()
+	t.Chdir(dir)
+	require.NoError(t, os.MkdirAll(filepath.Join("src", ".git"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join("src", "script1.groovy"), []byte("a"), 0o644))
+
+	w, err := newWatcher(func() []string { return []string{"src", "missing"} }, 50*time.Millisecond)
+	require.NoError(t, err)
+	start := time.Now()
+	scan := func(after time.Duration) []string {
+		changed, err := w.scan(start.Add(after))
+		require.NoError(t, err)
+		return changed
+	}
+	require.Empty(t, scan(0))
+
+	// changes in a row are handled together, once no change happened for the debounce delay.
+	require.NoError(t, os.WriteFile(filepath.Join("src", "script1.groovy"), []byte("ab"), 0o644))
+	require.Empty(t, scan(10*time.Millisecond))
+	require.NoError(t, os.WriteFile(filepath.Join("src", "script2.groovy"), []byte("a"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join("src", ".git", "index"), []byte("a"), 0o644))
+	require.NoError(t, os.MkdirAll("missing", 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join("missing", "test.groovy"), []byte("a"), 0o644))
+	require.Empty(t, scan(40*time.Millisecond))
+	require.Empty(t, scan(89*time.Millisecond))
+	require.Equal(t, []string{filepath.Join("missing", "test.groovy"), filepath.Join("src", "script1.groovy"), filepath.Join("src", "script2.groovy")}, scan(90*time.Millisecond))
+	require.Empty(t, scan(200*time.Millisecond))
+
+	require.NoError(t, os.Remove(filepath.Join("src", "script2.groovy")))
+	require.Empty(t, scan(210*time.Millisecond))
+	require.Equal(t, []string{filepath.Join("src", "script2.groovy")}, scan(260*time.Millisecond))
+}
+
+func TestWatchRoots(t *testing.T) {
+	require.Equal(t, []string{"inco.yaml", "src", filepath.Join("tests", "unit"), "test.groovy", ".", filepath.Join("src", "script1.groovy")}, WatchRoots(Config{
+		TestPaths: []string{"tests/unit/**/*Test.groovy", "!tests/unit/slow/**", "test.groovy", "*.cases.yaml", "src/"},
+		UploadScripts: []Iflow{
+			{ID: "iflow1", Scripts: []Script{{ID: "script1", Path: "src/script1.groovy"}}},
+			{ID: "iflow2", Scripts: []Script{{ID: "script2", Path: "test.groovy"}}},
+		},
+	}, "inco.yaml"))
+}
+
+func TestAffectedTests(t *testing.T) {
+	dir := t.TempDir()
+	t.Chdir(dir)
+	require.NoError(t, os.MkdirAll("tests", 0o755))
+	files := map[string]string{
+		"tests/script1Test.groovy":  "evaluate(new File('src/script1.groovy'))\n",
+		"tests/script2Test.groovy":  "evaluate(new File('src/script2.groovy'))\n",
+		"tests/script10Test.groovy": "def script = new GroovyShell().parse(new File('src/script10.groovy'))\nassert script instanceof script10\n",
+		"tests/bodyTest.groovy":     "// incoming payload\ndef body = new File('tests/body.xml').text\n",
+		"tests/script1.cases.yaml":  "script: script1\ncases:\n  - name: a\n    expected: {}\n",
+		"tests/script2.cases.yaml":  "script: src/script2.groovy\ncases:\n  - name: a\n    bodyFile: body.xml\n    expected: {}\n",
+	}
+	for path, content := range files {
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+	}
+	paths := []string{"tests/script1Test.groovy", "tests/script2Test.groovy", "tests/script10Test.groovy", "tests/bodyTest.groovy", "tests/script1.cases.yaml", "tests/script2.cases.yaml"}
+	scripts := []Script{
+		{ID: "script1", Type: ResourceTypeGroovy, Path: "src/script1.groovy", Tests: []MessageCase{{Name: "a"}}},
+		{ID: "script3", Type: ResourceTypeGroovy, Path: "src/script3.groovy", Tests: []MessageCase{{Name: "a", BodyFile: "tests/body3.xml"}}},
+	}
+
+	t.Run("Script", func(t *testing.T) {
+		affectedPaths, affectedScripts := AffectedTests([]string{filepath.FromSlash("src/script1.groovy")}, paths, scripts)
+		require.Equal(t, []string{"tests/script1Test.groovy", "tests/script1.cases.yaml"}, affectedPaths)
+		require.Equal(t, []Script{scripts[0], {ID: "script3", Type: ResourceTypeGroovy, Path: "src/script3.groovy"}}, affectedScripts)
+	})
+
+	t.Run("BodyFiles", func(t *testing.T) {
+		affectedPaths, affectedScripts := AffectedTests([]string{filepath.FromSlash("tests/body.xml"), filepath.FromSlash("tests/body3.xml")}, paths, scripts)
+		require.Equal(t, []string{"tests/bodyTest.groovy", "tests/script2.cases.yaml"}, affectedPaths)
+		require.Equal(t, []Script{{ID: "script1", Type: ResourceTypeGroovy, Path: "src/script1.groovy"}, scripts[1]}, affectedScripts)
+	})
+
+	t.Run("NamePrefix", func(t *testing.T) {
+		// script10Test.groovy mentions script10, neither script1 nor script1.groovy.
+		affectedPaths, _ := AffectedTests([]string{filepath.FromSlash("src/script1.groovy")}, paths, scripts)
+		require.NotContains(t, affectedPaths, "tests/script10Test.groovy")
+		affectedPaths, _ = AffectedTests([]string{filepath.FromSlash("src/script10.groovy")}, paths, scripts)
+		require.Equal(t, []string{"tests/script10Test.groovy"}, affectedPaths)
+	})
+
+	t.Run("Config", func(t *testing.T) {
+		// no test mentions inco.yaml, bodyTest.groovy only mentions incoming.
+		affectedPaths, _ := AffectedTests([]string{"inco.yaml"}, paths, scripts)
+		require.Empty(t, affectedPaths)
+	})
+
+	t.Run("Tests", func(t *testing.T) {
+		affectedPaths, affectedScripts := AffectedTests([]string{filepath.FromSlash("tests/script2Test.groovy")}, paths, scripts)
+		require.Equal(t, []string{"tests/script2Test.groovy"}, affectedPaths)
+		for _, script := range affectedScripts {
+			require.Empty(t, script.Tests)
+		}
+	})
+}
+
+func TestUploadChangedScripts(t *testing.T) {
+	client := &uploadRecorder{}
+	iflows := []Iflow{
+		{ID: "iflow1", Scripts: []Script{{ID: "script1", Path: "src/script1.groovy"}, {ID: "script2", Path: "src/script2.groovy"}}},
+		{ID: "iflow2", Scripts: []Script{{ID: "script3", Path: "src/script3.groovy"}, {ID: "script4", Path: "src/script4.groovy"}, {ID: "mapping", Type: ResourceTypeXSLT, Path: "src/mapping.xsl"}}},
+	}
+	readFile := func(path string) ([]byte, error) {
+		if path == "src/script4.groovy" {
+			return nil, fmt.Errorf("read failed")
+		}
+		return []byte(path), nil
+	}
+
+	require.NoError(t, UploadChangedScripts(t.Context(), client, readFile, iflows, []string{filepath.FromSlash("src/script1.groovy"), filepath.FromSlash("src/script3.groovy"), "inco.yaml"}))
+	require.Equal(t, []string{"script1", "script3"}, client.uploaded)
+	require.Empty(t, client.deployed)
+
+	err := UploadChangedScripts(t.Context(), client, readFile, iflows, []string{filepath.FromSlash("src/script2.groovy"), filepath.FromSlash("src/script4.groovy")})
+	require.ErrorContains(t, err, "some reading/uploading scripts failed")
+	require.Equal(t, []string{"script1", "script3", "script2"}, client.uploaded)
+
+	// the resources are checked before their upload, the malformed XSLT is not uploaded.
+	err = UploadChangedScripts(t.Context(), client, readFile, iflows, []string{filepath.FromSlash("src/mapping.xsl")})
+	require.ErrorContains(t, err, "some reading/uploading scripts failed")
+	require.Equal(t, []string{"script1", "script3", "script2"}, client.uploaded)
+}